@@ -0,0 +1,410 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"log"
+	"math"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// arrivalTick 开放模型启动任务的检查间隔
+const arrivalTick = 5 * time.Millisecond
+
+const (
+	// ArrivalRequestType 开放模型丢弃的任务记录为失败数据时使用的请求类型
+	ArrivalRequestType = "arrival"
+	// DroppedIterationsName 开放模型丢弃的任务记录为失败数据时使用的名称
+	DroppedIterationsName = "dropped_iterations"
+)
+
+var (
+	// ErrNotArrivalRate 未使用 ArrivalRate 设置开放模型
+	ErrNotArrivalRate = errors.New("lead is not running with arrival rate")
+	// ErrArrivalRateScale 开放模型不支持 Scale，请使用 SetArrivalRate
+	ErrArrivalRateScale = errors.New("lead is running with arrival rate, use SetArrivalRate instead of Scale")
+)
+
+// arrivalRate 开放模型设置，见 ArrivalRate
+type arrivalRate struct {
+	rate              float64
+	preAllocatedUsers int
+	maxUsers          int
+}
+
+// ArrivalRateStats 开放模型的统计数据
+type ArrivalRateStats struct {
+	// Rate 当前每秒启动的任务数
+	Rate float64
+	// Iterations 已启动的任务数
+	Iterations int64
+	// DroppedIterations 没有空闲虚拟用户且虚拟用户数已达上限，未能启动的任务数
+	DroppedIterations int64
+	// Users 已创建的虚拟用户数
+	Users int
+	// ActiveUsers 正在执行任务的虚拟用户数
+	ActiveUsers int64
+}
+
+// arrivalUser 开放模型的虚拟用户
+type arrivalUser struct {
+	line    ILine
+	user    Liner
+	handler TaskHandler
+	class   *arrivalClass
+}
+
+// arrivalClass 开放模型的一类虚拟用户
+type arrivalClass struct {
+	name    string
+	newLine func() ILine
+	weight  int
+	users   int
+}
+
+// arrivalExecutor 开放模型执行器，按固定速率启动任务，与任务的响应时间无关。
+// 每次启动的任务由一个空闲的虚拟用户执行，没有空闲虚拟用户时创建新的虚拟用户，
+// 虚拟用户数达到上限时丢弃该任务，记录为 DroppedIterations，同时记录一条 arrival 类型的失败数据。
+type arrivalExecutor struct {
+	lead     *Lead
+	rate     uint64
+	maxUsers int
+	classes  []*arrivalClass
+
+	idle chan *arrivalUser
+
+	mutex sync.Mutex
+	users []*arrivalUser
+
+	iterations int64
+	dropped    int64
+	active     int64
+	// allocating 正在创建的虚拟用户数，计入虚拟用户上限
+	allocating int
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func newArrivalExecutor(l *Lead, cfg *arrivalRate) *arrivalExecutor {
+	maxUsers := cfg.maxUsers
+	if maxUsers < cfg.preAllocatedUsers {
+		maxUsers = cfg.preAllocatedUsers
+	}
+	if maxUsers <= 0 {
+		maxUsers = 1
+	}
+
+	e := &arrivalExecutor{
+		lead:     l,
+		maxUsers: maxUsers,
+		idle:     make(chan *arrivalUser, maxUsers),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	e.setRate(cfg.rate)
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	return e
+}
+
+// start 创建预分配的虚拟用户并开始按速率启动任务
+func (e *arrivalExecutor) start(classes []*userClass, preAllocatedUsers int) {
+	for _, class := range classes {
+		e.classes = append(e.classes, &arrivalClass{name: class.name, newLine: class.newLine, weight: class.weight})
+	}
+
+	for i := 0; i < preAllocatedUsers && i < e.maxUsers; i++ {
+		if u := e.newUser(); u != nil {
+			e.idle <- u
+		}
+	}
+	go e.run()
+}
+
+func (e *arrivalExecutor) getRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&e.rate))
+}
+
+func (e *arrivalExecutor) setRate(rate float64) {
+	if rate < 0 {
+		rate = 0
+	}
+	atomic.StoreUint64(&e.rate, math.Float64bits(rate))
+}
+
+// run 按速率启动任务，速率可以在运行中调整
+func (e *arrivalExecutor) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(arrivalTick)
+	defer ticker.Stop()
+
+	last := time.Now()
+	var budget float64
+	for {
+		select {
+		case <-e.stopping:
+			return
+		case now := <-ticker.C:
+			budget += e.getRate() * now.Sub(last).Seconds()
+			last = now
+			for ; budget >= 1; budget-- {
+				e.startIteration()
+			}
+		}
+	}
+}
+
+// startIteration 使用空闲的虚拟用户启动一次任务，没有空闲虚拟用户时创建新的虚拟用户或丢弃该任务
+func (e *arrivalExecutor) startIteration() {
+	select {
+	case u := <-e.idle:
+		e.iterate(u)
+		return
+	default:
+	}
+
+	e.mutex.Lock()
+	if len(e.users)+e.allocating >= e.maxUsers {
+		e.mutex.Unlock()
+		atomic.AddInt64(&e.dropped, 1)
+		// 记录为失败数据，在 master 界面与阈值检查中可见
+		leadutil.RecordFailure(ArrivalRequestType, DroppedIterationsName, 0, fmt.Sprintf("no idle user and max users %d reached", e.maxUsers))
+		return
+	}
+	e.allocating++
+	e.mutex.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		u := e.newUser()
+		e.mutex.Lock()
+		e.allocating--
+		e.mutex.Unlock()
+		if u != nil {
+			e.iterate(u)
+		}
+	}()
+}
+
+// newUser 创建虚拟用户并执行 OnStart，按权重选择虚拟用户类，失败时返回 nil
+func (e *arrivalExecutor) newUser() *arrivalUser {
+	l := e.lead
+
+	e.mutex.Lock()
+	var class *arrivalClass
+	for _, c := range e.classes {
+		if class == nil || c.users*class.weight < class.users*c.weight {
+			class = c
+		}
+	}
+	if class == nil {
+		e.mutex.Unlock()
+		return nil
+	}
+	class.users++
+	e.mutex.Unlock()
+
+	line := class.newLine()
+	user, ok := line.(Liner)
+	if !ok {
+		user = &wrapLine{line}
+	}
+	l.addUser()
+	l.inject(line)
+	l.tagFilter.apply(user)
+	if err := e.startUser(class.name, user); err != nil {
+		if !errors.Is(err, leadutil.ErrFeederStop) {
+			l.limit.startFailed()
+		}
+		e.finish(user)
+		e.mutex.Lock()
+		class.users--
+		e.mutex.Unlock()
+		return nil
+	}
+
+	u := &arrivalUser{
+		line:    line,
+		user:    user,
+		handler: l.taskHandler(line, l.option.taskTimeout),
+		class:   class,
+	}
+	e.mutex.Lock()
+	e.users = append(e.users, u)
+	e.mutex.Unlock()
+	return u
+}
+
+// startUser 初始化虚拟用户并执行 OnStart，OnStart 失败或 panic 时调用 OnError 并返回错误
+func (e *arrivalExecutor) startUser(name string, user Liner) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			runPanic(user, r)
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	user.Init()
+	return e.lead.startUser(e.stopping, name, user)
+}
+
+// iterate 虚拟用户执行一次任务，执行完成后回到空闲状态，中断的虚拟用户被移除
+func (e *arrivalExecutor) iterate(u *arrivalUser) {
+	atomic.AddInt64(&e.iterations, 1)
+	atomic.AddInt64(&e.active, 1)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer atomic.AddInt64(&e.active, -1)
+		// 任务或中间件 panic 时移除该虚拟用户，同 forFn
+		defer func() {
+			if err := recover(); err != nil {
+				runPanic(u.user, err)
+				e.remove(u)
+			}
+		}()
+
+		task := u.user.Next()
+		if task != nil && e.lead.limit.take() {
+			u.handler(&TaskContext{Ctx: e.ctx, Task: task, Line: u.line})
+		} else if task == nil && u.user.Status() != StatusInterrupt {
+			u.user.OnError("NextTask", errors.New("next task not found"))
+		}
+
+		switch u.user.Status() {
+		case StatusInterrupt:
+			e.remove(u)
+			return
+		case StatusSkip:
+			u.user.ChangeStatus(StatusNormal)
+		}
+		if task == nil {
+			e.remove(u)
+			return
+		}
+		e.idle <- u
+	}()
+}
+
+// remove 移除虚拟用户并执行 OnFinish
+func (e *arrivalExecutor) remove(u *arrivalUser) {
+	e.mutex.Lock()
+	for i, user := range e.users {
+		if user == u {
+			e.users = append(e.users[:i], e.users[i+1:]...)
+			break
+		}
+	}
+	u.class.users--
+	e.mutex.Unlock()
+	e.finish(u.user)
+}
+
+// finish 执行 OnFinish 并归还虚拟用户持有的资源
+func (e *arrivalExecutor) finish(user Liner) {
+	defer func() {
+		if err := recover(); err != nil {
+			user.OnError("Run Panic", fmt.Errorf("%v", err))
+		}
+	}()
+	defer e.lead.doneUser()
+	defer ReleaseHeld(user)
+	user.OnFinish()
+}
+
+// stop 停止启动任务，等待执行中的任务完成，超过 timeout 后取消任务的 ctx，最后结束所有虚拟用户
+func (e *arrivalExecutor) stop(timeout time.Duration) {
+	e.stopOnce.Do(func() {
+		close(e.stopping)
+		<-e.done
+
+		finished := make(chan struct{})
+		go func() {
+			e.wg.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(timeout):
+			log.Printf("%d iterations are still running after the stop timeout, cancel them\n", atomic.LoadInt64(&e.active))
+			e.cancel()
+			<-finished
+		}
+		e.cancel()
+		if dropped := atomic.LoadInt64(&e.dropped); dropped > 0 {
+			log.Printf("%d iterations are dropped, no idle user and max users %d reached\n", dropped, e.maxUsers)
+		}
+
+		e.mutex.Lock()
+		users := e.users
+		e.users = nil
+		e.mutex.Unlock()
+		for _, u := range users {
+			e.finish(u.user)
+		}
+	})
+}
+
+func (e *arrivalExecutor) stats() *ArrivalRateStats {
+	e.mutex.Lock()
+	users := len(e.users)
+	e.mutex.Unlock()
+	return &ArrivalRateStats{
+		Rate:              e.getRate(),
+		Iterations:        atomic.LoadInt64(&e.iterations),
+		DroppedIterations: atomic.LoadInt64(&e.dropped),
+		Users:             users,
+		ActiveUsers:       atomic.LoadInt64(&e.active),
+	}
+}
+
+// SetArrivalRate 调整 ArrivalRate 启动的压测每秒启动的任务数
+func (l *Lead) SetArrivalRate(rate float64) error {
+	run := l.running()
+	if run == nil {
+		return ErrLeadNotRunning
+	}
+	if run.arrival == nil {
+		return ErrNotArrivalRate
+	}
+	run.arrival.setRate(rate)
+	return nil
+}
+
+// ArrivalRateStats 获取 ArrivalRate 启动的压测的统计数据，未运行或未使用 ArrivalRate 时返回 nil
+func (l *Lead) ArrivalRateStats() *ArrivalRateStats {
+	run := l.running()
+	if run == nil || run.arrival == nil {
+		return nil
+	}
+	return run.arrival.stats()
+}
+
+// runArrivalRate Run 使用开放模型时以单机模式运行，收到 SIGINT、SIGTERM 时结束
+func (l *Lead) runArrivalRate() {
+	if l.option.boomerClient == nil {
+		l.option.boomerClient = standaloneBoomer()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := l.Start(ctx); err != nil {
+		log.Fatalln(err)
+	}
+	l.Wait()
+}
@@ -0,0 +1,340 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// arrivalLine 测试用的开放模型虚拟用户，task 为每次执行的任务
+type arrivalLine struct {
+	*Line
+	counter *arrivalCounter
+}
+
+// arrivalCounter 统计开放模型虚拟用户的执行情况
+type arrivalCounter struct {
+	started    int64
+	finished   int64
+	iterations int64
+	canceled   int64
+}
+
+func newArrivalLine(counter *arrivalCounter, task func(ctx context.Context)) func() ILine {
+	return func() ILine {
+		l := &arrivalLine{Line: NewLine(), counter: counter}
+		l.AddWeightFuncCtx(func(ctx context.Context) {
+			atomic.AddInt64(&counter.iterations, 1)
+			task(ctx)
+		}, 1)
+		return l
+	}
+}
+
+func (l *arrivalLine) OnStart() error {
+	atomic.AddInt64(&l.counter.started, 1)
+	return nil
+}
+
+func (l *arrivalLine) OnFinish() {
+	atomic.AddInt64(&l.counter.finished, 1)
+}
+
+// startArrivalExecutor 创建并启动只有一类虚拟用户的开放模型执行器
+func startArrivalExecutor(counter *arrivalCounter, cfg *arrivalRate, task func(ctx context.Context)) (*Lead, *arrivalExecutor) {
+	l := New()
+	e := newArrivalExecutor(l, cfg)
+	e.start([]*userClass{{name: "arrivalLine", weight: 1, newLine: newArrivalLine(counter, task)}}, cfg.preAllocatedUsers)
+	return l, e
+}
+
+func TestArrivalExecutorRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		duration time.Duration
+		min, max int64
+	}{
+		{name: "zero rate", rate: 0, duration: 200 * time.Millisecond, min: 0, max: 0},
+		{name: "100 per second", rate: 100, duration: 500 * time.Millisecond, min: 25, max: 75},
+		{name: "400 per second", rate: 400, duration: 500 * time.Millisecond, min: 100, max: 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &arrivalCounter{}
+			_, e := startArrivalExecutor(counter, &arrivalRate{rate: tt.rate, preAllocatedUsers: 5, maxUsers: 20}, func(ctx context.Context) {})
+			time.Sleep(tt.duration)
+			e.stop(time.Second)
+
+			stats := e.stats()
+			if stats.Iterations < tt.min || stats.Iterations > tt.max {
+				t.Fatalf("%d iterations in %v, want [%d, %d]", stats.Iterations, tt.duration, tt.min, tt.max)
+			}
+			if stats.DroppedIterations != 0 {
+				t.Fatalf("%d iterations are dropped", stats.DroppedIterations)
+			}
+			if n := atomic.LoadInt64(&counter.iterations); n != stats.Iterations {
+				t.Fatalf("%d tasks run, want %d", n, stats.Iterations)
+			}
+		})
+	}
+}
+
+func TestArrivalExecutorUsers(t *testing.T) {
+	counter := &arrivalCounter{}
+	release := make(chan struct{})
+	var failures, dropped int64
+	oldFailure := leadutil.RecordFailure
+	leadutil.RecordFailure = func(requestType, name string, responseTime int64, exception string) {
+		if requestType == ArrivalRequestType && name == DroppedIterationsName {
+			atomic.AddInt64(&dropped, 1)
+			return
+		}
+		atomic.AddInt64(&failures, 1)
+	}
+	defer func() { leadutil.RecordFailure = oldFailure }()
+
+	l, e := startArrivalExecutor(counter, &arrivalRate{rate: 0, preAllocatedUsers: 2, maxUsers: 4}, func(ctx context.Context) {
+		<-release
+	})
+	// 预分配的虚拟用户在启动时创建
+	if stats := e.stats(); stats.Users != 2 || atomic.LoadInt64(&counter.started) != 2 {
+		t.Fatalf("users = %d, started = %d, want 2 preallocated users", stats.Users, counter.started)
+	}
+
+	// 任务阻塞时空闲虚拟用户用完后创建新的虚拟用户，达到上限后丢弃任务
+	e.setRate(200)
+	waitFor(t, "dropped iterations", func() bool { return e.stats().DroppedIterations > 0 })
+	stats := e.stats()
+	if stats.Users != 4 || stats.ActiveUsers != 4 || stats.Iterations != 4 {
+		t.Fatalf("unexpected stats when max users reached: %+v", stats)
+	}
+	if n := atomic.LoadInt64(&failures); n != 0 {
+		t.Fatalf("dropped iterations are recorded as %d failures of the tasks", n)
+	}
+
+	close(release)
+	e.stop(time.Second)
+	if n, want := atomic.LoadInt64(&dropped), e.stats().DroppedIterations; n != want {
+		t.Fatalf("%d dropped iterations recorded, want %d", n, want)
+	}
+	if n := atomic.LoadInt64(&counter.finished); n != 4 {
+		t.Fatalf("OnFinish called %d times, want 4", n)
+	}
+	if n := l.ActiveUsers(); n != 0 {
+		t.Fatalf("ActiveUsers() = %d after stop", n)
+	}
+}
+
+func TestArrivalExecutorSetRate(t *testing.T) {
+	counter := &arrivalCounter{}
+	_, e := startArrivalExecutor(counter, &arrivalRate{rate: 0, preAllocatedUsers: 1, maxUsers: 5}, func(ctx context.Context) {})
+	defer e.stop(time.Second)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := e.stats().Iterations; n != 0 {
+		t.Fatalf("%d iterations with zero rate", n)
+	}
+	e.setRate(200)
+	if rate := e.stats().Rate; rate != 200 {
+		t.Fatalf("Rate = %v, want 200", rate)
+	}
+	waitFor(t, "iterations", func() bool { return e.stats().Iterations >= 10 })
+
+	e.setRate(-1)
+	if rate := e.stats().Rate; rate != 0 {
+		t.Fatalf("Rate = %v, want 0 for a negative rate", rate)
+	}
+	time.Sleep(20 * time.Millisecond)
+	n := e.stats().Iterations
+	time.Sleep(50 * time.Millisecond)
+	if m := e.stats().Iterations; m != n {
+		t.Fatalf("iterations grow from %d to %d after the rate is set to 0", n, m)
+	}
+}
+
+func TestArrivalExecutorStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     func(ctx context.Context)
+		timeout  time.Duration
+		canceled bool
+	}{
+		{
+			name:    "wait for running iterations",
+			task:    func(ctx context.Context) { time.Sleep(50 * time.Millisecond) },
+			timeout: time.Second,
+		},
+		{
+			name:     "cancel iterations after the stop timeout",
+			task:     func(ctx context.Context) { <-ctx.Done() },
+			timeout:  50 * time.Millisecond,
+			canceled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &arrivalCounter{}
+			task := func(ctx context.Context) {
+				tt.task(ctx)
+				if ctx.Err() != nil {
+					atomic.AddInt64(&counter.canceled, 1)
+				}
+			}
+			l, e := startArrivalExecutor(counter, &arrivalRate{rate: 100, preAllocatedUsers: 2, maxUsers: 2}, task)
+			waitFor(t, "running iterations", func() bool { return e.stats().ActiveUsers == 2 })
+
+			start := time.Now()
+			e.stop(tt.timeout)
+			if elapsed := time.Since(start); elapsed > tt.timeout+time.Second {
+				t.Fatalf("stop takes %v", elapsed)
+			}
+			if canceled := atomic.LoadInt64(&counter.canceled) > 0; canceled != tt.canceled {
+				t.Fatalf("iterations canceled = %v, want %v", canceled, tt.canceled)
+			}
+			stats := e.stats()
+			if stats.ActiveUsers != 0 || stats.Users != 0 {
+				t.Fatalf("unexpected stats after stop: %+v", stats)
+			}
+			if n := atomic.LoadInt64(&counter.finished); n != 2 {
+				t.Fatalf("OnFinish called %d times, want 2", n)
+			}
+			if n := l.ActiveUsers(); n != 0 {
+				t.Fatalf("ActiveUsers() = %d after stop", n)
+			}
+
+			// 停止后不再启动任务
+			n := e.stats().Iterations
+			time.Sleep(30 * time.Millisecond)
+			if m := e.stats().Iterations; m != n {
+				t.Fatalf("iterations grow from %d to %d after stop", n, m)
+			}
+		})
+	}
+}
+
+func TestLeadArrivalRate(t *testing.T) {
+	counter := &arrivalCounter{}
+	l := New(ArrivalRate(100, 1, 5))
+	l.ResetLine(newArrivalLine(counter, func(ctx context.Context) {}))
+
+	if err := l.SetArrivalRate(10); !errors.Is(err, ErrLeadNotRunning) {
+		t.Fatalf("SetArrivalRate() before Start = %v, want %v", err, ErrLeadNotRunning)
+	}
+	if l.ArrivalRateStats() != nil {
+		t.Fatal("ArrivalRateStats() before Start should be nil")
+	}
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Scale(10, 0); !errors.Is(err, ErrArrivalRateScale) {
+		t.Fatalf("Scale() = %v, want %v", err, ErrArrivalRateScale)
+	}
+	waitFor(t, "iterations", func() bool { return l.ArrivalRateStats().Iterations >= 5 })
+	if err := l.SetArrivalRate(50); err != nil {
+		t.Fatal(err)
+	}
+	if rate := l.ArrivalRateStats().Rate; rate != 50 {
+		t.Fatalf("Rate = %v, want 50", rate)
+	}
+	l.Stop()
+	l.Wait()
+	if n := atomic.LoadInt64(&counter.finished); n != atomic.LoadInt64(&counter.started) {
+		t.Fatalf("OnFinish called %d times, OnStart called %d times", n, counter.started)
+	}
+
+	// 闭合模型不支持 SetArrivalRate
+	closed := New(Interval("10ms"))
+	closed.ResetLine(newArrivalLine(counter, func(ctx context.Context) {}))
+	if err := closed.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		closed.Stop()
+		closed.Wait()
+	}()
+	if err := closed.SetArrivalRate(10); !errors.Is(err, ErrNotArrivalRate) {
+		t.Fatalf("SetArrivalRate() = %v, want %v", err, ErrNotArrivalRate)
+	}
+}
+
+// panicLine 开放模型中 OnStart 或任务 panic 的虚拟用户
+type panicLine struct {
+	*arrivalLine
+	startPanic bool
+	panics     *int64
+}
+
+func (l *panicLine) OnStart() error {
+	l.arrivalLine.OnStart()
+	if l.startPanic {
+		panic("login panic")
+	}
+	return nil
+}
+
+func (l *panicLine) OnError(operationName string, err error) {
+	if operationName == "Run Panic" {
+		atomic.AddInt64(l.panics, 1)
+	}
+}
+
+func TestArrivalExecutorPanic(t *testing.T) {
+	tests := []struct {
+		name       string
+		startPanic bool
+		// rawTask 任务不经过 AddWeightFunc 的 panic 保护
+		rawTask    bool
+		middleware Middleware
+	}{
+		{name: "OnStart panics", startPanic: true},
+		{name: "task panics", rawTask: true},
+		{
+			name: "middleware panics",
+			middleware: func(next TaskHandler) TaskHandler {
+				return func(tc *TaskContext) { panic("middleware panic") }
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &arrivalCounter{}
+			var panics int64
+			l := New()
+			if tt.middleware != nil {
+				l.Use(tt.middleware)
+			}
+			newLine := func() ILine {
+				line := &panicLine{arrivalLine: &arrivalLine{Line: NewLine(), counter: counter}, startPanic: tt.startPanic, panics: &panics}
+				if tt.rawTask {
+					line.AddTask(&Task{Fn: func() { panic("task panic") }, Weight: 1})
+				} else {
+					line.AddWeightFunc(func() { atomic.AddInt64(&counter.iterations, 1) }, 1)
+				}
+				return line
+			}
+			e := newArrivalExecutor(l, &arrivalRate{rate: 200, preAllocatedUsers: 1, maxUsers: 2})
+			e.start([]*userClass{{name: "panicLine", weight: 1, newLine: newLine}}, 1)
+			waitFor(t, "panics", func() bool { return atomic.LoadInt64(&panics) >= 5 })
+			e.stop(time.Second)
+
+			// panic 的虚拟用户被移除并执行 OnFinish
+			if started, finished := atomic.LoadInt64(&counter.started), atomic.LoadInt64(&counter.finished); started != finished {
+				t.Fatalf("OnStart called %d times, OnFinish called %d times", started, finished)
+			}
+			if n := l.ActiveUsers(); n != 0 {
+				t.Fatalf("ActiveUsers() = %d after stop", n)
+			}
+			if stats := e.stats(); stats.Users != 0 || stats.ActiveUsers != 0 {
+				t.Fatalf("unexpected stats after stop: %+v", stats)
+			}
+		})
+	}
+}
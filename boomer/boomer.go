@@ -1,11 +1,14 @@
 package boomer
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -46,6 +49,10 @@ type Boomer struct {
 
 	outputs []Output
 
+	userClassMode bool
+	stopTimeout   time.Duration
+	loadShape     LoadShape
+
 	logger *log.Logger
 }
 
@@ -103,6 +110,34 @@ func (b *Boomer) SetMode(mode Mode) {
 	}
 }
 
+// EnableUserClassMode binds every spawned goroutine to one task, like a user class in locust,
+// instead of running all the tasks in turn. Users are distributed over tasks by their weights,
+// and the number of users of each task is reported as user_classes_count.
+// It must be called before the test is started.
+func (b *Boomer) EnableUserClassMode() {
+	b.userClassMode = true
+}
+
+// SetStopTimeout sets how long to wait for the goroutines to finish their running tasks when stopping,
+// the ctx passed to Task.FnCtx is cancelled after the timeout. By default, the ctx is cancelled immediately.
+// In distributed mode, it's overridden by the stop_timeout of master if it's set.
+func (b *Boomer) SetStopTimeout(stopTimeout time.Duration) {
+	b.stopTimeout = stopTimeout
+}
+
+// SetLoadShape sets a load shape to control the number of users and the spawn rate over time,
+// instead of the spawnCount and spawnRate passed to NewStandaloneBoomer.
+// The test is shut down when the shape is done. It's only supported in standalone mode,
+// and it must be called before the test is started.
+func (b *Boomer) SetLoadShape(shape LoadShape) {
+	b.loadShape = shape
+}
+
+// Mode returns the running mode of the boomer.
+func (b *Boomer) Mode() Mode {
+	return b.mode
+}
+
 // AddOutput accepts outputs which implements the boomer.Output interface.
 func (b *Boomer) AddOutput(o Output) {
 	b.outputs = append(b.outputs, o)
@@ -122,6 +157,16 @@ func (b *Boomer) EnableMemoryProfile(memoryProfileFile string, duration time.Dur
 
 // Run accepts a slice of Task and connects to the locust master.
 func (b *Boomer) Run(tasks ...*Task) {
+	b.run(tasks, true)
+}
+
+// Start is like Run, but it returns as soon as the tasks are started in standalone mode.
+// Use Quit to stop the tasks.
+func (b *Boomer) Start(tasks ...*Task) {
+	b.run(tasks, false)
+}
+
+func (b *Boomer) run(tasks []*Task, block bool) {
 	if b.cpuProfileFile != "" {
 		err := StartCPUProfile(b.cpuProfileFile, b.cpuProfileDuration)
 		if err != nil {
@@ -139,6 +184,8 @@ func (b *Boomer) Run(tasks ...*Task) {
 	case DistributedMode:
 		b.slaveRunner = newSlaveRunner(b.masterHost, b.masterPort, tasks, b.rateLimiter)
 		b.slaveRunner.setLogger(b.logger)
+		b.slaveRunner.userClassMode = b.userClassMode
+		b.slaveRunner.setStopTimeout(b.stopTimeout)
 		b.logger.Println("new slave runner")
 		for _, o := range b.outputs {
 			b.slaveRunner.addOutput(o)
@@ -147,16 +194,53 @@ func (b *Boomer) Run(tasks ...*Task) {
 	case StandaloneMode:
 		b.localRunner = newLocalRunner(tasks, b.rateLimiter, b.spawnCount, b.spawnRate)
 		b.localRunner.setLogger(b.logger)
+		b.localRunner.userClassMode = b.userClassMode
+		b.localRunner.setStopTimeout(b.stopTimeout)
+		b.localRunner.loadShape = b.loadShape
 		b.logger.Println("new local runner")
 		for _, o := range b.outputs {
 			b.localRunner.addOutput(o)
 		}
-		b.localRunner.run()
+		if block {
+			b.localRunner.run()
+		} else {
+			b.localRunner.start()
+		}
 	default:
 		b.logger.Println("Invalid mode, expected boomer.DistributedMode or boomer.StandaloneMode")
 	}
 }
 
+// Scale changes the number of users while running, it's only supported in standalone mode,
+// the number of users is controlled by the master in distributed mode.
+// The users are added or removed at spawnRate per second, or at once if spawnRate <= 0,
+// a scaling in progress is interrupted by the next one.
+func (b *Boomer) Scale(spawnCount int, spawnRate float64) error {
+	if b.mode != StandaloneMode {
+		return errors.New("scaling is only supported in standalone mode")
+	}
+	if b.localRunner == nil {
+		return errors.New("boomer is not running")
+	}
+	return b.localRunner.scale(spawnCount, spawnRate)
+}
+
+// Stats returns the accumulated stats since the test started.
+// It returns nil if boomer is not running.
+func (b *Boomer) Stats() *StatsSnapshot {
+	switch b.mode {
+	case DistributedMode:
+		if b.slaveRunner != nil {
+			return b.slaveRunner.snapshot()
+		}
+	case StandaloneMode:
+		if b.localRunner != nil {
+			return b.localRunner.snapshot()
+		}
+	}
+	return nil
+}
+
 // RecordSuccess reports a success.
 func (b *Boomer) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
 	if b.localRunner == nil && b.slaveRunner == nil {
@@ -216,6 +300,7 @@ func (b *Boomer) SendCustomMessage(messageType string, data interface{}) {
 }
 
 // Quit will send a quit message to the master.
+// The running tasks are stopped in the stop timeout, see SetStopTimeout.
 func (b *Boomer) Quit() {
 	Events.Publish(EVENT_QUIT)
 	var ticker = time.NewTicker(3 * time.Second)
@@ -233,6 +318,8 @@ func (b *Boomer) Quit() {
 		b.slaveRunner.shutdown()
 	case StandaloneMode:
 		b.localRunner.shutdown()
+		// wait for all the workers are stopped, so the runner won't publish events after quitting
+		<-b.localRunner.doneChan
 	}
 }
 
@@ -246,7 +333,11 @@ func runTasksForTest(tasks ...*Task) {
 			for _, name := range taskNames {
 				if name == task.Name {
 					log.Println("Running " + task.Name)
-					task.Fn()
+					if task.FnCtx != nil {
+						task.FnCtx(context.Background())
+					} else {
+						task.Fn()
+					}
 				}
 			}
 		}
@@ -276,6 +367,9 @@ func Run(tasks ...*Task) {
 	defaultBoomer.masterPort = masterPort
 	defaultBoomer.EnableMemoryProfile(memoryProfileFile, memoryProfileDuration)
 	defaultBoomer.EnableCPUProfile(cpuProfileFile, cpuProfileDuration)
+	if stopTimeout > 0 {
+		defaultBoomer.SetStopTimeout(stopTimeout)
+	}
 
 	defaultBoomer.Run(tasks...)
 
@@ -295,12 +389,46 @@ func Run(tasks ...*Task) {
 	case <-c:
 		quitByMe = true
 		defaultBoomer.Quit()
+	case <-quitRequest:
+		quitByMe = true
+		defaultBoomer.Quit()
 	case <-quitChan:
 	}
 
 	log.Println("shutdown")
 }
 
+var (
+	quitRequest     = make(chan struct{})
+	quitRequestOnce sync.Once
+)
+
+// Quit asks Run to stop the defaultBoomer, as if the process received SIGINT.
+// In distributed mode, a quit message is sent to the master. Run returns after that.
+func Quit() {
+	quitRequestOnce.Do(func() {
+		close(quitRequest)
+	})
+}
+
+// EnableUserClassMode binds every spawned goroutine to one task.
+// It's a convenience function to use the defaultBoomer.
+func EnableUserClassMode() {
+	defaultBoomer.EnableUserClassMode()
+}
+
+// SetStopTimeout sets how long to wait for the goroutines to finish their running tasks when stopping.
+// It's a convenience function to use the defaultBoomer.
+func SetStopTimeout(stopTimeout time.Duration) {
+	defaultBoomer.SetStopTimeout(stopTimeout)
+}
+
+// Stats returns the accumulated stats since the test started, it returns nil if Run isn't called.
+// It's a convenience function to use the defaultBoomer.
+func Stats() *StatsSnapshot {
+	return defaultBoomer.Stats()
+}
+
 // RecordSuccess reports a success.
 // It's a convenience function to use the defaultBoomer.
 func RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
@@ -1,6 +1,7 @@
 package boomer
 
 import (
+	"context"
 	"flag"
 	"log"
 	"math"
@@ -94,6 +95,53 @@ var _ = Describe("Test Boomer", func() {
 		Eventually(func() string { return "mem.pprof" }).Should(BeAnExistingFile())
 	})
 
+	It("test standalone start and scale", func() {
+		b := NewStandaloneBoomer(0, 0)
+		b.EnableUserClassMode()
+
+		taskA := &Task{
+			Name:   "A",
+			Weight: 1,
+			FnCtx: func(ctx context.Context) {
+				<-ctx.Done()
+			},
+		}
+		taskB := &Task{
+			Name:   "B",
+			Weight: 3,
+			FnCtx: func(ctx context.Context) {
+				<-ctx.Done()
+			},
+		}
+		Expect(b.Scale(10, 10)).To(HaveOccurred())
+		Expect(b.Stats()).To(BeNil())
+
+		b.Start(taskA, taskB)
+		Expect(b.Stats().UserCount).To(BeEquivalentTo(0))
+
+		Expect(b.Scale(8, 0)).To(Succeed())
+		snapshot := b.Stats()
+		Expect(snapshot.UserCount).To(BeEquivalentTo(8))
+		Expect(snapshot.UserClassesCount).To(Equal(map[string]int64{"A": 2, "B": 6}))
+
+		b.RecordSuccess("http", "foo", 1, 10)
+		Eventually(func() int64 { return b.Stats().Total.NumRequests }).Should(BeEquivalentTo(1))
+
+		// the users are removed at the spawn rate
+		Expect(b.Scale(4, 40)).To(Succeed())
+		Expect(b.Stats().UserCount).To(BeNumerically(">", 4))
+		Eventually(func() map[string]int64 { return b.Stats().UserClassesCount }).Should(Equal(map[string]int64{"A": 1, "B": 3}))
+
+		b.Quit()
+		Expect(b.Scale(8, 10)).To(HaveOccurred())
+		Expect(b.Stats()).To(BeNil())
+	})
+
+	It("test scale in distributed mode", func() {
+		b := NewBoomer("0.0.0.0", 1234)
+		Expect(b.Scale(10, 10)).To(HaveOccurred())
+	})
+
 	It("test distributed run", func() {
 		masterHost := "mock:0.0.0.0"
 		masterPort := 10240
@@ -125,7 +173,7 @@ var _ = Describe("Test Boomer", func() {
 		MockGomqDealerInstance.RecvChannel() <- serverZmtpMessage
 
 		time.Sleep(4 * time.Second)
-		Expect(count).Should(BeEquivalentTo(10))
+		Expect(atomic.LoadInt64(&count)).Should(BeEquivalentTo(10))
 	})
 
 	It("test run tasks for test", func() {
@@ -193,8 +241,23 @@ var _ = Describe("Test Boomer", func() {
 			},
 		}
 
+		// drop the messages left by the other tests
+		for len(MockGomqDealerInstance.SendChannel()) > 0 {
+			<-MockGomqDealerInstance.SendChannel()
+		}
 		go Run(taskA)
-		time.Sleep(50 * time.Millisecond)
+		// the runner is created by Run in another goroutine, get its node id from the client_ready message
+		nodeID := ""
+		Eventually(func() string {
+			select {
+			case raw := <-MockGomqDealerInstance.SendChannel():
+				if msg, err := newClientReadyMessageFromBytes(raw); err == nil && msg.Type == "client_ready" {
+					nodeID = msg.NodeID
+				}
+			default:
+			}
+			return nodeID
+		}, 3*time.Second).ShouldNot(BeEmpty())
 		defer defaultBoomer.Quit()
 
 		serverMessage := newGenericMessage("spawn", map[string]interface{}{
@@ -202,7 +265,7 @@ var _ = Describe("Test Boomer", func() {
 				"Dummy":  int64(5),
 				"Dummy2": int64(5),
 			},
-		}, defaultBoomer.slaveRunner.nodeID)
+		}, nodeID)
 		serverMessageInBytes, _ := serverMessage.serialize()
 		serverZmtpMessage := &zmtp.Message{
 			MessageType: zmtp.UserMessage,
@@ -211,7 +274,7 @@ var _ = Describe("Test Boomer", func() {
 		MockGomqDealerInstance.RecvChannel() <- serverZmtpMessage
 
 		time.Sleep(4 * time.Second)
-		Expect(count).To(BeEquivalentTo(10))
+		Expect(atomic.LoadInt64(&count)).To(BeEquivalentTo(10))
 	})
 
 	It("test record success", func() {
@@ -5,6 +5,7 @@ import "github.com/asaskevich/EventBus"
 const (
 	EVENT_CONNECTED = "boomer:connected"
 	EVENT_SPAWN     = "boomer:spawn"
+	EVENT_SPAWNING  = "boomer:spawning" // published with the current and the target number of users while spawning
 	EVENT_STOP      = "boomer:stop"
 	EVENT_QUIT      = "boomer:quit"
 )
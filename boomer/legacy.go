@@ -22,6 +22,7 @@ var memoryProfileFile string
 var memoryProfileDuration time.Duration
 var cpuProfileFile string
 var cpuProfileDuration time.Duration
+var stopTimeout time.Duration
 
 var successRetiredWarning = &sync.Once{}
 var failureRetiredWarning = &sync.Once{}
@@ -177,4 +178,5 @@ func init() {
 	flag.DurationVar(&memoryProfileDuration, "mem-profile-duration", 30*time.Second, "Memory profile duration.")
 	flag.StringVar(&cpuProfileFile, "cpu-profile", "", "Enable CPU profiling.")
 	flag.DurationVar(&cpuProfileDuration, "cpu-profile-duration", 30*time.Second, "CPU profile duration.")
+	flag.DurationVar(&stopTimeout, "stop-timeout", 0, "How long to wait for users to finish their running tasks when stopping, users are stopped immediately by default. It's overridden by the stop_timeout of master if it's set in distributed mode.")
 }
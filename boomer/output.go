@@ -6,6 +6,7 @@ import (
 	"log"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
@@ -133,8 +134,9 @@ func (o *ConsoleOutput) OnEvent(data map[string]interface{}) {
 	}
 
 	currentTime := time.Now()
-	o.logger.Println(fmt.Sprintf("Current time: %s, Users: %d, Total RPS: %d, Total Fail Ratio: %.1f%%",
-		currentTime.Format("2006/01/02 15:04:05"), output.UserCount, output.TotalRPS, output.TotalFailRatio*100))
+	o.logger.Println(fmt.Sprintf("Current time: %s, Users: %d%s, Total RPS: %d, Total Fail Ratio: %.1f%%",
+		currentTime.Format("2006/01/02 15:04:05"), output.UserCount, formatUserClassesCount(output.UserClassesCount),
+		output.TotalRPS, output.TotalFailRatio*100))
 	noPrefixLogger := log.New(o.logger.Writer(), "", 0)
 	table := tablewriter.NewWriter(noPrefixLogger.Writer())
 	table.SetHeader([]string{"Type", "Name", "# requests", "# fails", "Median", "Average", "Min", "Max", "Content Size", "# reqs/sec", "# fails/sec"})
@@ -158,6 +160,24 @@ func (o *ConsoleOutput) OnEvent(data map[string]interface{}) {
 	o.logger.Println()
 }
 
+// formatUserClassesCount formats user classes count like " (A: 1, B: 2)", sorted by name.
+func formatUserClassesCount(userClassesCount map[string]int64) string {
+	if len(userClassesCount) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(userClassesCount))
+	for name := range userClassesCount {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s: %d", name, userClassesCount[name]))
+	}
+	return " (" + strings.Join(counts, ", ") + ")"
+}
+
 type statsEntryOutput struct {
 	statsEntry
 
@@ -169,12 +189,13 @@ type statsEntryOutput struct {
 }
 
 type dataOutput struct {
-	UserCount      int32                             `json:"user_count"`
-	TotalStats     *statsEntryOutput                 `json:"stats_total"`
-	TotalRPS       int64                             `json:"total_rps"`
-	TotalFailRatio float64                           `json:"total_fail_ratio"`
-	Stats          []*statsEntryOutput               `json:"stats"`
-	Errors         map[string]map[string]interface{} `json:"errors"`
+	UserCount        int32                             `json:"user_count"`
+	UserClassesCount map[string]int64                  `json:"user_classes_count"`
+	TotalStats       *statsEntryOutput                 `json:"stats_total"`
+	TotalRPS         int64                             `json:"total_rps"`
+	TotalFailRatio   float64                           `json:"total_fail_ratio"`
+	Stats            []*statsEntryOutput               `json:"stats"`
+	Errors           map[string]map[string]interface{} `json:"errors"`
 }
 
 func convertData(data map[string]interface{}) (output *dataOutput, err error) {
@@ -194,12 +215,16 @@ func convertData(data map[string]interface{}) (output *dataOutput, err error) {
 		return nil, err
 	}
 
+	// user_classes_count is only available in user class mode
+	userClassesCount, _ := data["user_classes_count"].(map[string]int64)
+
 	output = &dataOutput{
-		UserCount:      userCount,
-		TotalStats:     entryTotalOutput,
-		TotalRPS:       getCurrentRps(entryTotalOutput.NumRequests, entryTotalOutput.NumReqsPerSec),
-		TotalFailRatio: getTotalFailRatio(entryTotalOutput.NumRequests, entryTotalOutput.NumFailures),
-		Stats:          make([]*statsEntryOutput, 0, len(stats)),
+		UserCount:        userCount,
+		UserClassesCount: userClassesCount,
+		TotalStats:       entryTotalOutput,
+		TotalRPS:         getCurrentRps(entryTotalOutput.NumRequests, entryTotalOutput.NumReqsPerSec),
+		TotalFailRatio:   getTotalFailRatio(entryTotalOutput.NumRequests, entryTotalOutput.NumFailures),
+		Stats:            make([]*statsEntryOutput, 0, len(stats)),
 	}
 
 	// convert stats
@@ -48,6 +48,14 @@ var _ = Describe("test output", func() {
 		Expect(avgContentLength).To(BeEquivalentTo(0))
 	})
 
+	It("test format user classes count", func() {
+		Expect(formatUserClassesCount(nil)).To(Equal(""))
+		Expect(formatUserClassesCount(map[string]int64{
+			"Seller": 1,
+			"Buyer":  3,
+		})).To(Equal(" (Buyer: 3, Seller: 1)"))
+	})
+
 	It("test get current rps", func() {
 		numRequests := int64(10)
 		numReqsPerSecond := map[int64]int64{}
@@ -5,6 +5,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -33,6 +34,32 @@ type RateLimiter interface {
 	Stop()
 }
 
+// refillBroadcast wakes up all the goroutines blocked on an exhausted bucket when it's refilled.
+type refillBroadcast struct {
+	mutex   sync.RWMutex
+	channel chan bool
+}
+
+func newRefillBroadcast() *refillBroadcast {
+	return &refillBroadcast{channel: make(chan bool)}
+}
+
+// wait blocks until the bucket is refilled.
+func (b *refillBroadcast) wait() {
+	b.mutex.RLock()
+	channel := b.channel
+	b.mutex.RUnlock()
+	<-channel
+}
+
+// refilled wakes up the waiting goroutines.
+func (b *refillBroadcast) refilled() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	close(b.channel)
+	b.channel = make(chan bool)
+}
+
 // A StableRateLimiter uses the token bucket algorithm.
 // the bucket is refilled according to the refill period, no burst is allowed.
 type StableRateLimiter struct {
@@ -40,7 +67,7 @@ type StableRateLimiter struct {
 	currentThreshold int64
 	timerId          uint64
 	refillPeriod     time.Duration
-	broadcastChannel chan bool
+	broadcast        *refillBroadcast
 	quitChannel      chan bool
 }
 
@@ -51,7 +78,7 @@ func NewStableRateLimiter(threshold int64, refillPeriod time.Duration) (rateLimi
 		currentThreshold: threshold,
 		timerId:          uint64(0),
 		refillPeriod:     refillPeriod,
-		broadcastChannel: make(chan bool),
+		broadcast:        newRefillBroadcast(),
 	}
 	return rateLimiter
 }
@@ -74,8 +101,7 @@ func (limiter *StableRateLimiter) Start() {
 					return
 				}
 				atomic.StoreInt64(&limiter.currentThreshold, limiter.threshold)
-				close(limiter.broadcastChannel)
-				limiter.broadcastChannel = make(chan bool)
+				limiter.broadcast.refilled()
 			}
 		}
 	}(timerId)
@@ -87,7 +113,7 @@ func (limiter *StableRateLimiter) Acquire() (blocked bool) {
 	if permit < 0 {
 		blocked = true
 		// block until the bucket is refilled
-		<-limiter.broadcastChannel
+		limiter.broadcast.wait()
 	} else {
 		blocked = false
 	}
@@ -114,7 +140,7 @@ type RampUpRateLimiter struct {
 	rampUpRate       string
 	rampUpStep       int64
 	rampUpPeroid     time.Duration
-	broadcastChannel chan bool
+	broadcast        *refillBroadcast
 	quitChannel      chan bool
 }
 
@@ -128,7 +154,7 @@ func NewRampUpRateLimiter(maxThreshold int64, rampUpRate string, refillPeriod ti
 		timerId:          uint64(0),
 		rampUpRate:       rampUpRate,
 		refillPeriod:     refillPeriod,
-		broadcastChannel: make(chan bool),
+		broadcast:        newRefillBroadcast(),
 	}
 	rateLimiter.rampUpStep, rateLimiter.rampUpPeroid, err = rateLimiter.parseRampUpRate(rateLimiter.rampUpRate)
 	if err != nil {
@@ -163,7 +189,7 @@ func (limiter *RampUpRateLimiter) parseRampUpRate(rampUpRate string) (rampUpStep
 }
 
 func (limiter *RampUpRateLimiter) getNextThreshold() int64 {
-	nextValue := limiter.nextThreshold + limiter.rampUpStep
+	nextValue := atomic.LoadInt64(&limiter.nextThreshold) + limiter.rampUpStep
 	if nextValue < 0 {
 		// int64 overflow
 		nextValue = int64(math.MaxInt64)
@@ -181,7 +207,7 @@ func (limiter *RampUpRateLimiter) Start() {
 	quitChannel := limiter.quitChannel
 
 	atomic.StoreInt64(&limiter.nextThreshold, limiter.getNextThreshold())
-	atomic.StoreInt64(&limiter.currentThreshold, limiter.nextThreshold)
+	atomic.StoreInt64(&limiter.currentThreshold, atomic.LoadInt64(&limiter.nextThreshold))
 	// bucket updater
 	go func(myId uint64) {
 		for {
@@ -196,9 +222,8 @@ func (limiter *RampUpRateLimiter) Start() {
 					return
 				}
 
-				atomic.StoreInt64(&limiter.currentThreshold, limiter.nextThreshold)
-				close(limiter.broadcastChannel)
-				limiter.broadcastChannel = make(chan bool)
+				atomic.StoreInt64(&limiter.currentThreshold, atomic.LoadInt64(&limiter.nextThreshold))
+				limiter.broadcast.refilled()
 			}
 		}
 	}(timerId)
@@ -229,7 +254,7 @@ func (limiter *RampUpRateLimiter) Acquire() (blocked bool) {
 	if permit < 0 {
 		blocked = true
 		// block until the bucket is refilled
-		<-limiter.broadcastChannel
+		limiter.broadcast.wait()
 	} else {
 		blocked = false
 	}
@@ -238,6 +263,6 @@ func (limiter *RampUpRateLimiter) Acquire() (blocked bool) {
 
 // Stop the rate limiter.
 func (limiter *RampUpRateLimiter) Stop() {
-	limiter.nextThreshold = 0
+	atomic.StoreInt64(&limiter.nextThreshold, 0)
 	close(limiter.quitChannel)
 }
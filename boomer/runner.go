@@ -2,6 +2,7 @@ package boomer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -17,18 +18,24 @@ const (
 	stateInit     = "ready"
 	stateSpawning = "spawning"
 	stateRunning  = "running"
+	stateStopping = "stopping"
 	stateStopped  = "stopped"
 	stateQuitting = "quitting"
 )
 
 const (
+	// workerCancelTimeout is how long to wait for the workers to return after cancelling their tasks
+	workerCancelTimeout    = 1 * time.Second
 	slaveReportInterval    = 3 * time.Second
 	heartbeatInterval      = 1 * time.Second
 	masterHeartbeatTimeout = 60 * time.Second
 )
 
 type runner struct {
-	state string
+	// state is changed by the listener and the spawning goroutines, and read by the others,
+	// use getState and setState to access it.
+	state      string
+	stateMutex sync.RWMutex
 
 	tasks           []*Task
 	totalTaskWeight int
@@ -41,11 +48,28 @@ type runner struct {
 	// TODO: we save user_class_count in spawn message and send it back to master without modification, may be a bad idea?
 	userClassesCountFromMaster map[string]int64
 
+	// In user class mode, every worker is bound to one task, just like a user class in locust.
+	// The workers are grouped by task name.
+	userClassMode    bool
+	userClassWorkers map[string][]*worker
+
 	numClients int32
 	spawnRate  float64
 
-	// Cancellation method for all running workers(goroutines)
-	cancelFuncs []context.CancelFunc
+	// spawning is the spawning in progress, protected by spawningMutex
+	spawning      *spawning
+	spawningMutex sync.Mutex
+
+	// All running workers(goroutines)
+	workers []*worker
+	// workersMutex protects workers and userClassWorkers
+	workersMutex sync.RWMutex
+
+	// stopTimeout is how long to wait for the workers to finish their running tasks when stopping,
+	// stored as int64 nanoseconds, because it can be changed by the spawn message.
+	stopTimeout int64
+	// forceStopped is the number of workers whose running tasks are cancelled after the stop timeout
+	forceStopped int64
 
 	// close this channel will stop all goroutines used in runner, including running workers.
 	shutdownChan chan bool
@@ -130,95 +154,302 @@ func (r *runner) outputOnStop() {
 	wg.Wait()
 }
 
-// addWorkers start the goroutines and add it to cancelFuncs
+// worker is a goroutine running tasks, it can be stopped gracefully.
+type worker struct {
+	// stop asks the worker to return after the running task
+	stop context.CancelFunc
+	// cancel cancels the ctx of the running task
+	cancel context.CancelFunc
+	// done is closed after the worker returns
+	done chan bool
+}
+
+type stoppingKey struct{}
+
+// Stopping returns a channel that's closed when the goroutine running the task is asked to stop.
+// A long-running task should return as soon as possible after that, before its ctx is cancelled
+// when the stop timeout is reached. If ctx isn't passed by boomer, it returns ctx.Done().
+func Stopping(ctx context.Context) <-chan struct{} {
+	if stopping, ok := ctx.Value(stoppingKey{}).(<-chan struct{}); ok {
+		return stopping
+	}
+	return ctx.Done()
+}
+
+// newWorker starts a goroutine running task, if task is nil, tasks are picked up according to their weights.
+func (r *runner) newWorker(task *Task) *worker {
+	ctx, cancel := context.WithCancel(context.TODO())
+	stopCtx, stop := context.WithCancel(ctx)
+	w := &worker{
+		stop:   stop,
+		cancel: cancel,
+		done:   make(chan bool),
+	}
+	go func() {
+		defer close(w.done)
+		r.runWorker(stopCtx, context.WithValue(ctx, stoppingKey{}, stopCtx.Done()), task)
+	}()
+	return w
+}
+
+// addWorkers start the goroutines and add it to workers
 func (r *runner) addWorkers(gapCount int) {
 	for i := 0; i < gapCount; i++ {
 		select {
 		case <-r.shutdownChan:
 			return
 		default:
-			ctx, cancel := context.WithCancel(context.TODO())
-			r.cancelFuncs = append(r.cancelFuncs, cancel)
-			go func(ctx context.Context) {
-				index := 0
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case <-r.shutdownChan:
-						return
-					default:
-						if r.rateLimitEnabled {
-							blocked := r.rateLimiter.Acquire()
-							if !blocked {
-								task := r.getTask(index)
-								r.safeRun(task.Fn)
-								index++
-								if index == r.totalTaskWeight {
-									index = 0
-								}
-							}
-						} else {
-							task := r.getTask(index)
-							r.safeRun(task.Fn)
-							index++
-							if index == r.totalTaskWeight {
-								index = 0
-							}
-						}
-					}
-					runtime.Gosched()
+			w := r.newWorker(nil)
+			r.workersMutex.Lock()
+			r.workers = append(r.workers, w)
+			r.workersMutex.Unlock()
+		}
+	}
+}
+
+// addUserClassWorkers start the goroutines bound to task and add it to userClassWorkers
+func (r *runner) addUserClassWorkers(task *Task, gapCount int) {
+	for i := 0; i < gapCount; i++ {
+		select {
+		case <-r.shutdownChan:
+			return
+		default:
+			w := r.newWorker(task)
+			r.workersMutex.Lock()
+			r.userClassWorkers[task.Name] = append(r.userClassWorkers[task.Name], w)
+			r.workersMutex.Unlock()
+		}
+	}
+}
+
+// runWorker runs tasks in a loop until stopCtx is cancelled or the runner is shut down.
+// If task is nil, tasks are picked up according to their weights.
+func (r *runner) runWorker(stopCtx context.Context, ctx context.Context, task *Task) {
+	index := 0
+	for {
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-r.shutdownChan:
+			return
+		default:
+			if r.rateLimitEnabled {
+				blocked := r.rateLimiter.Acquire()
+				if !blocked {
+					r.runWorkerTask(ctx, task, &index)
 				}
-			}(ctx)
+			} else {
+				r.runWorkerTask(ctx, task, &index)
+			}
 		}
+		runtime.Gosched()
 	}
 }
 
-// reduceWorkers Stop the goroutines and remove it from the cancelFuncs
+func (r *runner) runWorkerTask(ctx context.Context, task *Task, index *int) {
+	if task == nil {
+		task = r.getTask(*index)
+		*index++
+		if *index == r.totalTaskWeight {
+			*index = 0
+		}
+	}
+	if task.FnCtx != nil {
+		r.safeRun(func() {
+			task.FnCtx(ctx)
+		})
+		return
+	}
+	r.safeRun(task.Fn)
+}
+
+// stopWorkers asks the workers to stop and waits for them to return in the stop timeout,
+// then cancels the ctx of the running tasks of the workers which are still running.
+// If the stop timeout isn't set, the running tasks are cancelled immediately.
+func (r *runner) stopWorkers(workers []*worker) {
+	for _, w := range workers {
+		w.stop()
+	}
+
+	stopTimeout := r.getStopTimeout()
+	if stopTimeout <= 0 {
+		for _, w := range workers {
+			w.cancel()
+		}
+		return
+	}
+
+	timer := time.NewTimer(stopTimeout)
+	defer timer.Stop()
+wait:
+	for _, w := range workers {
+		select {
+		case <-w.done:
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	forceStopped := int64(0)
+	for _, w := range workers {
+		select {
+		case <-w.done:
+		default:
+			forceStopped++
+		}
+		w.cancel()
+	}
+	if forceStopped == 0 {
+		return
+	}
+	atomic.AddInt64(&r.forceStopped, forceStopped)
+	r.logger.Printf("%d users didn't stop in %v, their tasks are cancelled\n", forceStopped, stopTimeout)
+
+	// give the cancelled workers a moment to clean up, e.g. running OnFinish in navigator
+	cancelTimer := time.NewTimer(workerCancelTimeout)
+	defer cancelTimer.Stop()
+	for _, w := range workers {
+		select {
+		case <-w.done:
+		case <-cancelTimer.C:
+			return
+		}
+	}
+}
+
+// reduceWorkers Stop the goroutines and remove it from the workers
 func (r *runner) reduceWorkers(gapCount int) {
 	if gapCount == 0 {
 		return
 	}
-	num := len(r.cancelFuncs) - gapCount
-	for _, cancelFunc := range r.cancelFuncs[num:] {
-		cancelFunc()
+	r.workersMutex.Lock()
+	defer r.workersMutex.Unlock()
+
+	num := len(r.workers) - gapCount
+	if num < 0 {
+		num = 0
 	}
+	go r.stopWorkers(r.workers[num:])
+
+	r.workers = r.workers[:num]
+}
 
-	r.cancelFuncs = r.cancelFuncs[:num]
+// reduceUserClassWorkers Stop the goroutines bound to the task named name and remove it from the userClassWorkers
+func (r *runner) reduceUserClassWorkers(name string, gapCount int) {
+	if gapCount == 0 {
+		return
+	}
+	r.workersMutex.Lock()
+	defer r.workersMutex.Unlock()
 
+	workers := r.userClassWorkers[name]
+	num := len(workers) - gapCount
+	if num < 0 {
+		num = 0
+	}
+	go r.stopWorkers(workers[num:])
+	r.userClassWorkers[name] = workers[:num]
 }
 
-func (r *runner) spawnWorkers(spawnCount int, spawnCompleteFunc func()) {
-	r.logger.Println("The total number of clients required is ", spawnCount)
+// spawnUserClassWorkers adds or removes goroutines of each task at once, so that the number of goroutines
+// bound to a task equals to userClassesCount[task.Name].
+func (r *runner) getState() string {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.state
+}
 
-	var gapCount int
-	if spawnCount > int(r.numClients) {
-		gapCount = spawnCount - int(r.numClients)
-		r.logger.Printf("The current number of clients is %v, %v clients will be added\n", r.numClients, gapCount)
-		r.addWorkers(gapCount)
-	} else {
-		gapCount = int(r.numClients) - spawnCount
-		r.logger.Printf("The current number of clients is %v, %v clients will be removed\n", r.numClients, gapCount)
-		r.reduceWorkers(gapCount)
+func (r *runner) setState(state string) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	r.state = state
+}
+
+// compareAndSetState changes the state to new only if it's old, and reports whether it's changed.
+func (r *runner) compareAndSetState(old, new string) bool {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.state != old {
+		return false
 	}
+	r.state = new
+	return true
+}
 
-	r.numClients = int32(spawnCount)
+func (r *runner) spawnUserClassWorkers(userClassesCount map[string]int, spawnCompleteFunc func()) {
+	r.spawn(func() []spawnStep {
+		return r.userClassSpawnSteps(userClassesCount)
+	}, 0, spawnCompleteFunc)
+}
 
-	if spawnCompleteFunc != nil {
-		go spawnCompleteFunc() //For faster time
+func (r *runner) userClassCount(name string) int {
+	r.workersMutex.RLock()
+	defer r.workersMutex.RUnlock()
+	return len(r.userClassWorkers[name])
+}
+
+// userClassesCount returns the current number of goroutines of each task in user class mode.
+func (r *runner) userClassesCount() map[string]int64 {
+	r.workersMutex.RLock()
+	defer r.workersMutex.RUnlock()
+
+	userClassesCount := make(map[string]int64, len(r.tasks))
+	for _, task := range r.tasks {
+		userClassesCount[task.Name] = int64(len(r.userClassWorkers[task.Name]))
 	}
+	return userClassesCount
+}
+
+// distributeUsers divides amount of users among tasks by their weights. The remainder goes to the tasks
+// with the largest fractional parts, so the ratio between tasks keeps stable while scaling up and down.
+func distributeUsers(amount int, tasks []*Task) map[string]int {
+	userClassesCount := make(map[string]int, len(tasks))
+	weightSum := 0
+	for _, task := range tasks {
+		weightSum += task.Weight
+	}
+	if weightSum <= 0 || amount <= 0 {
+		for _, task := range tasks {
+			userClassesCount[task.Name] = 0
+		}
+		return userClassesCount
+	}
+
+	assigned := 0
+	remainders := make([]int, len(tasks))
+	for i, task := range tasks {
+		count := amount * task.Weight / weightSum
+		userClassesCount[task.Name] = count
+		remainders[i] = amount * task.Weight % weightSum
+		assigned += count
+	}
+
+	for ; assigned < amount; assigned++ {
+		largest := 0
+		for i := range tasks {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		userClassesCount[tasks[largest].Name]++
+		remainders[largest] = -1
+	}
+	return userClassesCount
+}
+
+// spawnWorkers adds or removes goroutines at once, so that the number of goroutines equals to spawnCount.
+func (r *runner) spawnWorkers(spawnCount int, spawnCompleteFunc func()) {
+	r.logger.Println("The total number of clients required is ", spawnCount)
+	r.spawn(func() []spawnStep {
+		return r.spawnSteps(spawnCount)
+	}, 0, spawnCompleteFunc)
 }
 
 // setTasks will set the runner's task list AND the total task weight
 // which is used to get a task later
 func (r *runner) setTasks(t []*Task) {
 	r.tasks = t
-	if len(r.tasks) == 1 {
-		r.totalTaskWeight = 1
-		r.runTask = t
-		return
-	}
-
+	r.userClassWorkers = make(map[string][]*worker)
 	weightSum := 0
 	for _, task := range r.tasks {
 		if task.Weight <= 0 { //Ensure that user input values are legal
@@ -226,16 +457,28 @@ func (r *runner) setTasks(t []*Task) {
 		}
 		weightSum += task.Weight
 	}
+	if len(r.tasks) == 1 {
+		r.totalTaskWeight = 1
+		r.runTask = t
+		return
+	}
+
 	r.totalTaskWeight = weightSum
 
+	// Task.Weight is kept untouched, it's used to distribute users in user class mode.
+	weights := make([]int, len(r.tasks))
+	for i, task := range r.tasks {
+		weights[i] = task.Weight
+	}
+
 	r.runTask = make([]*Task, r.totalTaskWeight)
 	index := 0
 	for weightSum > 0 { //Assign task order according to weight
-		for _, task := range r.tasks {
-			if task.Weight > 0 {
+		for i, task := range r.tasks {
+			if weights[i] > 0 {
 				r.runTask[index] = task
 				index++
-				task.Weight--
+				weights[i]--
 				weightSum--
 			}
 		}
@@ -246,10 +489,29 @@ func (r *runner) getTask(index int) *Task {
 	return r.runTask[index]
 }
 
+// startSpawning adds or removes goroutines at spawnRate per second until the number of goroutines equals to spawnCount,
+// or at once if spawnRate <= 0. It interrupts the spawning in progress, and publishes EVENT_SPAWNING while spawning.
 func (r *runner) startSpawning(spawnCount int, spawnRate float64, spawnCompleteFunc func()) {
 	Events.Publish(EVENT_SPAWN, spawnCount, spawnRate)
 
-	r.spawnWorkers(spawnCount, spawnCompleteFunc)
+	r.logger.Println("The total number of clients required is ", spawnCount)
+	r.spawn(func() []spawnStep {
+		return r.spawnSteps(spawnCount)
+	}, spawnRate, spawnCompleteFunc)
+}
+
+// startSpawningUserClasses is like startSpawning, but the number of goroutines is given for each task.
+func (r *runner) startSpawningUserClasses(userClassesCount map[string]int, spawnRate float64, spawnCompleteFunc func()) {
+	spawnCount := 0
+	for _, count := range userClassesCount {
+		spawnCount += count
+	}
+	Events.Publish(EVENT_SPAWN, spawnCount, spawnRate)
+
+	r.logger.Println("The total number of clients required is ", spawnCount)
+	r.spawn(func() []spawnStep {
+		return r.userClassSpawnSteps(userClassesCount)
+	}, spawnRate, spawnCompleteFunc)
 }
 
 func (r *runner) stop() {
@@ -257,14 +519,48 @@ func (r *runner) stop() {
 	// user's code can subscribe to this event and do thins like cleaning up
 	Events.Publish(EVENT_STOP)
 
-	r.reduceWorkers(int(r.numClients)) //Stop all goroutines
-	r.numClients = 0
+	//Stop all goroutines
+	r.stopSpawning()
+	workers := r.takeWorkers()
+	atomic.StoreInt32(&r.numClients, 0)
+	r.stopWorkers(workers)
+}
+
+// takeWorkers removes all the workers from the runner and returns them.
+func (r *runner) takeWorkers() []*worker {
+	r.workersMutex.Lock()
+	defer r.workersMutex.Unlock()
+
+	workers := r.workers
+	r.workers = nil
+	for _, userClassWorkers := range r.userClassWorkers {
+		workers = append(workers, userClassWorkers...)
+	}
+	r.userClassWorkers = make(map[string][]*worker)
+	return workers
+}
+
+func (r *runner) getStopTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.stopTimeout))
+}
+
+func (r *runner) setStopTimeout(stopTimeout time.Duration) {
+	atomic.StoreInt64(&r.stopTimeout, int64(stopTimeout))
 }
 
 type localRunner struct {
 	runner
 
 	spawnCount int
+
+	// spawnMutex serializes the spawning triggered by run and scale
+	spawnMutex sync.Mutex
+	// doneChan is closed after all the workers are stopped
+	doneChan     chan bool
+	shutdownOnce sync.Once
+
+	// loadShape controls the number of workers instead of spawnCount if it's set
+	loadShape LoadShape
 }
 
 func newLocalRunner(tasks []*Task, rateLimiter RateLimiter, spawnCount int, spawnRate float64) (r *localRunner) {
@@ -274,6 +570,7 @@ func newLocalRunner(tasks []*Task, rateLimiter RateLimiter, spawnCount int, spaw
 	r.spawnRate = spawnRate
 	r.spawnCount = spawnCount
 	r.shutdownChan = make(chan bool)
+	r.doneChan = make(chan bool)
 
 	if rateLimiter != nil {
 		r.rateLimitEnabled = true
@@ -285,22 +582,29 @@ func newLocalRunner(tasks []*Task, rateLimiter RateLimiter, spawnCount int, spaw
 }
 
 func (r *localRunner) run() {
-	r.state = stateInit
+	r.start()
+	<-r.doneChan
+}
+
+// start is like run, but it doesn't wait for the runner to be shut down.
+func (r *localRunner) start() {
+	r.setState(stateInit)
 	r.stats.start()
 	r.outputOnStart()
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
 	go func() {
 		for {
 			select {
 			case data := <-r.stats.messageToRunnerChan:
-				data["user_count"] = r.numClients
+				data["user_count"] = atomic.LoadInt32(&r.numClients)
+				if r.userClassMode {
+					data["user_classes_count"] = r.userClassesCount()
+				}
 				r.outputOnEevent(data)
 			case <-r.shutdownChan:
 				Events.Publish(EVENT_QUIT)
 				r.stop()
-				wg.Done()
+				close(r.doneChan)
 				r.outputOnStop()
 				return
 			}
@@ -310,19 +614,84 @@ func (r *localRunner) run() {
 	if r.rateLimitEnabled {
 		r.rateLimiter.Start()
 	}
+	if r.loadShape != nil {
+		go r.runLoadShape()
+		return
+	}
+	r.spawnMutex.Lock()
 	r.startSpawning(r.spawnCount, r.spawnRate, nil)
+	r.spawnMutex.Unlock()
+}
 
-	wg.Wait()
+// runLoadShape polls the load shape and scales the workers until the shape is done or the runner is shut down.
+func (r *localRunner) runLoadShape() {
+	ticker := time.NewTicker(loadShapeTickInterval)
+	defer ticker.Stop()
+
+	startTime := time.Now()
+	lastCount, lastRate := -1, 0.0
+	for {
+		spawnCount, spawnRate, done := r.loadShape.Tick(time.Since(startTime))
+		if done {
+			r.logger.Println("The load shape is done, shutting down")
+			r.shutdown()
+			return
+		}
+		if spawnCount != lastCount || spawnRate != lastRate {
+			if err := r.scale(spawnCount, spawnRate); err != nil {
+				return
+			}
+			lastCount, lastRate = spawnCount, spawnRate
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.shutdownChan:
+			return
+		}
+	}
 }
 
-func (r *localRunner) shutdown() {
-	if r.stats != nil {
-		r.stats.close()
+// scale changes the number of workers while running.
+func (r *localRunner) scale(spawnCount int, spawnRate float64) error {
+	r.spawnMutex.Lock()
+	defer r.spawnMutex.Unlock()
+
+	select {
+	case <-r.shutdownChan:
+		return errors.New("runner is shut down")
+	default:
 	}
-	if r.rateLimitEnabled {
-		r.rateLimiter.Stop()
+	r.spawnCount = spawnCount
+	r.spawnRate = spawnRate
+	r.startSpawning(spawnCount, spawnRate, nil)
+	return nil
+}
+
+// snapshot returns the accumulated stats and the current number of workers.
+func (r *runner) snapshot() *StatsSnapshot {
+	snapshot := r.stats.getSnapshot()
+	if snapshot == nil {
+		return nil
 	}
-	close(r.shutdownChan)
+	snapshot.UserCount = atomic.LoadInt32(&r.numClients)
+	snapshot.ForceStoppedCount = atomic.LoadInt64(&r.forceStopped)
+	if r.userClassMode {
+		snapshot.UserClassesCount = r.userClassesCount()
+	}
+	return snapshot
+}
+
+func (r *localRunner) shutdown() {
+	r.shutdownOnce.Do(func() {
+		if r.stats != nil {
+			r.stats.close()
+		}
+		if r.rateLimitEnabled {
+			r.rateLimiter.Stop()
+		}
+		close(r.shutdownChan)
+	})
 }
 
 func (r *localRunner) sendCustomMessage(messageType string, data interface{}) {
@@ -335,14 +704,19 @@ func (r *localRunner) sendCustomMessage(messageType string, data interface{}) {
 type slaveRunner struct {
 	runner
 
-	nodeID                       string
-	masterHost                   string
-	masterPort                   int
-	waitForAck                   sync.WaitGroup
+	nodeID     string
+	masterHost string
+	masterPort int
+	// waitForAck and ackReceived are reset when client_ready is sent, protected by ackMutex
+	waitForAck                   *sync.WaitGroup
 	ackReceived                  int32
+	ackMutex                     sync.Mutex
 	lastReceivedSpawnTimestamp   int64
 	lastMasterHeartbeatTimestamp time.Time
 	client                       client
+	// stopDone is closed when the graceful stop triggered by the stop message is done.
+	// It's only accessed by the listener goroutine, and nil if not stopping.
+	stopDone chan struct{}
 }
 
 func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimiter RateLimiter) (r *slaveRunner) {
@@ -351,7 +725,7 @@ func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimite
 	r.masterHost = masterHost
 	r.masterPort = masterPort
 	r.setTasks(tasks)
-	r.waitForAck = sync.WaitGroup{}
+	r.waitForAck = &sync.WaitGroup{}
 	r.nodeID = getNodeID()
 	r.shutdownChan = make(chan bool)
 
@@ -366,19 +740,36 @@ func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimite
 
 func (r *slaveRunner) spawnComplete() {
 	data := make(map[string]interface{})
-	data["count"] = r.numClients
-	data["user_classes_count"] = r.userClassesCountFromMaster
+	data["count"] = atomic.LoadInt32(&r.numClients)
+	data["user_classes_count"] = r.reportedUserClassesCount()
 	r.client.sendChannel() <- newGenericMessage("spawning_complete", data, r.nodeID)
-	r.state = stateRunning
+	// The runner may be stopping or spawning again when the spawning completes.
+	r.compareAndSetState(stateSpawning, stateRunning)
+}
+
+// reportedUserClassesCount returns the user_classes_count sent to master.
+// In user class mode, it's the actual number of goroutines of each task.
+func (r *slaveRunner) reportedUserClassesCount() map[string]int64 {
+	if r.userClassMode {
+		return r.userClassesCount()
+	}
+	return r.userClassesCountFromMaster
 }
 
 func (r *slaveRunner) onQuiting() {
-	if r.state != stateQuitting {
+	if r.getState() != stateQuitting {
 		r.client.sendChannel() <- newGenericMessage("quit", nil, r.nodeID)
 	}
 }
 
+// shutdown stops the workers in the stop timeout like the stop message does, then closes the stats and the client,
+// so that the requests of the stopping workers are still recorded.
 func (r *slaveRunner) shutdown() {
+	r.stopSpawning()
+	workers := r.takeWorkers()
+	atomic.StoreInt32(&r.numClients, 0)
+	r.stopWorkers(workers)
+
 	if r.stats != nil {
 		r.stats.close()
 	}
@@ -388,8 +779,6 @@ func (r *slaveRunner) shutdown() {
 	if r.rateLimitEnabled {
 		r.rateLimiter.Stop()
 	}
-	r.cancelFuncs = nil
-	r.numClients = 0
 	close(r.shutdownChan)
 }
 
@@ -413,10 +802,32 @@ func (r *slaveRunner) sumUsersAmount(msg *genericMessage) int {
 	return amount
 }
 
+// matchUserClasses maps user_classes_count from master to tasks with the same name.
+// User classes without a task of the same name are ignored. It returns false if none of
+// the user classes matches.
+func (r *slaveRunner) matchUserClasses() (userClassesCount map[string]int, matched bool) {
+	userClassesCount = make(map[string]int, len(r.tasks))
+	for _, task := range r.tasks {
+		userClassesCount[task.Name] = 0
+	}
+
+	for class, num := range r.userClassesCountFromMaster {
+		if _, ok := userClassesCount[class]; !ok {
+			r.logger.Printf("No task named %s for user class in spawn message, %d users ignored\n", class, num)
+			continue
+		}
+		userClassesCount[class] = int(num)
+		matched = true
+	}
+	return userClassesCount, matched
+}
+
 // TODO: Since locust 2.0, spawn rate and user count are both handled by master.
 // But user count is divided by user classes defined in locustfile, because locust assumes that
 // master and workers use the same locustfile. Before we find a better way to deal with this,
 // boomer sums up the total amout of users in spawn message and uses task weight to spawn goroutines like before.
+// In user class mode, if user classes in spawn message have tasks of the same name, each task
+// gets exactly the number of goroutines of its user class.
 func (r *slaveRunner) onSpawnMessage(msg *genericMessage) {
 	if timeStamp, ok := msg.Data["timestamp"]; ok {
 		if timeStampInt64, ok := castToInt64(timeStamp); ok {
@@ -429,9 +840,24 @@ func (r *slaveRunner) onSpawnMessage(msg *genericMessage) {
 		}
 	}
 
+	// stop_timeout is in seconds, it's nil if it isn't set in master
+	if stopTimeout, ok := castToFloat64(msg.Data["stop_timeout"]); ok {
+		r.setStopTimeout(time.Duration(stopTimeout * float64(time.Second)))
+	}
+
+	// Since locust 2.0, master ramps up the users by itself and doesn't send spawn_rate,
+	// the users in the spawn message are spawned at once in that case.
+	spawnRate, _ := castToFloat64(msg.Data["spawn_rate"])
+
 	r.client.sendChannel() <- newGenericMessage("spawning", nil, r.nodeID)
 	workers := r.sumUsersAmount(msg)
-	r.startSpawning(workers, float64(workers), r.spawnComplete)
+	if r.userClassMode {
+		if userClassesCount, ok := r.matchUserClasses(); ok {
+			r.startSpawningUserClasses(userClassesCount, spawnRate, r.spawnComplete)
+			return
+		}
+	}
+	r.startSpawning(workers, spawnRate, r.spawnComplete)
 }
 
 // TODO: consider to add register_message instead of publishing any unknown type as custom_message.
@@ -444,24 +870,30 @@ func (r *slaveRunner) onCustomMessage(msg *CustomMessage) {
 
 func (r *slaveRunner) onAckMessage(msg *genericMessage) {
 	// Maybe we should add a state for waiting?
+	r.ackMutex.Lock()
 	if !atomic.CompareAndSwapInt32(&r.ackReceived, 0, 1) {
+		r.ackMutex.Unlock()
 		r.logger.Println("Receive duplicate ack message, ignored")
 		return
 	}
-	r.waitForAck.Done()
+	waitForAck := r.waitForAck
+	r.ackMutex.Unlock()
+	waitForAck.Done()
 	Events.Publish(EVENT_CONNECTED)
 }
 
 func (r *slaveRunner) sendClientReadyAndWaitForAck() {
-	r.waitForAck = sync.WaitGroup{}
-	r.waitForAck.Add(1)
-
+	waitForAck := &sync.WaitGroup{}
+	waitForAck.Add(1)
+	r.ackMutex.Lock()
+	r.waitForAck = waitForAck
 	atomic.StoreInt32(&r.ackReceived, 0)
+	r.ackMutex.Unlock()
 	// locust allows workers to bypass version check by sending -1 as version
 	r.client.sendChannel() <- newClientReadyMessage("client_ready", -1, r.nodeID)
 
 	go func() {
-		if waitTimeout(&r.waitForAck, 5*time.Second) {
+		if waitTimeout(waitForAck, 5*time.Second) {
 			r.logger.Println("Timeout waiting for ack message from master, you may use a locust version before 2.10.0 or have a network issue.")
 		}
 	}()
@@ -492,13 +924,13 @@ func (r *slaveRunner) onMessage(msgInterface message) {
 		return
 	}
 
-	switch r.state {
+	switch r.getState() {
 	case stateInit:
 		switch msgType {
 		case "ack":
 			r.onAckMessage(genericMsg)
 		case "spawn":
-			r.state = stateSpawning
+			r.setState(stateSpawning)
 			r.stats.clearStatsChan <- true
 			r.onSpawnMessage(genericMsg)
 		case "quit":
@@ -511,38 +943,69 @@ func (r *slaveRunner) onMessage(msgInterface message) {
 	case stateRunning:
 		switch msgType {
 		case "spawn":
-			r.state = stateSpawning
+			r.setState(stateSpawning)
 			r.onSpawnMessage(genericMsg)
 		case "stop":
-			r.stop()
-			r.state = stateStopped
-			r.logger.Println("Recv stop message from master, all the goroutines are stopped")
-			r.client.sendChannel() <- newGenericMessage("client_stopped", nil, r.nodeID)
-			r.sendClientReadyAndWaitForAck()
-			r.state = stateInit
+			r.startStopping()
 		case "quit":
 			r.stop()
 			r.logger.Println("Recv quit message from master, all the goroutines are stopped")
 			Events.Publish(EVENT_QUIT)
-			r.state = stateInit
+			r.setState(stateInit)
+		default:
+			r.onCustomMessage(customMsg)
+		}
+	case stateStopping:
+		switch msgType {
+		case "quit":
+			r.logger.Println("Recv quit message from master while stopping")
+			Events.Publish(EVENT_QUIT)
+			r.setState(stateInit)
 		default:
 			r.onCustomMessage(customMsg)
 		}
 	case stateStopped:
 		switch msgType {
 		case "spawn":
-			r.state = stateSpawning
+			r.setState(stateSpawning)
 			r.stats.clearStatsChan <- true
 			r.onSpawnMessage(genericMsg)
 		case "quit":
 			Events.Publish(EVENT_QUIT)
-			r.state = stateInit
+			r.setState(stateInit)
 		default:
 			r.onCustomMessage(customMsg)
 		}
 	}
 }
 
+// startStopping stops the workers gracefully in another goroutine, which may take up to the stop timeout,
+// so the listener keeps handling heartbeats and quit messages from the master in the meantime.
+// onStopped is called by the listener when it's done.
+func (r *slaveRunner) startStopping() {
+	r.setState(stateStopping)
+	done := make(chan struct{})
+	r.stopDone = done
+	go func() {
+		r.stop()
+		close(done)
+	}()
+}
+
+// onStopped tells the master that the workers are stopped and gets ready for the next spawn.
+// Nothing is sent if the runner quits while stopping.
+func (r *slaveRunner) onStopped() {
+	r.stopDone = nil
+	if r.getState() != stateStopping {
+		return
+	}
+	r.setState(stateStopped)
+	r.logger.Println("Recv stop message from master, all the goroutines are stopped")
+	r.client.sendChannel() <- newGenericMessage("client_stopped", nil, r.nodeID)
+	r.sendClientReadyAndWaitForAck()
+	r.setState(stateInit)
+}
+
 func (r *slaveRunner) sendCustomMessage(messageType string, data interface{}) {
 	msg := newCustomMessage(messageType, data, r.nodeID)
 	r.client.sendChannel() <- msg
@@ -554,6 +1017,8 @@ func (r *slaveRunner) startListener() {
 			select {
 			case msg := <-r.client.recvChannel():
 				r.onMessage(msg)
+			case <-r.stopDone:
+				r.onStopped()
 			case <-r.shutdownChan:
 				return
 			}
@@ -562,7 +1027,7 @@ func (r *slaveRunner) startListener() {
 }
 
 func (r *slaveRunner) run() {
-	r.state = stateInit
+	r.setState(stateInit)
 	r.client = newClient(r.masterHost, r.masterPort, r.nodeID)
 
 	err := r.client.connect()
@@ -592,11 +1057,11 @@ func (r *slaveRunner) run() {
 		for {
 			select {
 			case data := <-r.stats.messageToRunnerChan:
-				if r.state == stateInit || r.state == stateStopped {
+				if state := r.getState(); state == stateInit || state == stateStopped {
 					continue
 				}
-				data["user_count"] = r.numClients
-				data["user_classes_count"] = r.userClassesCountFromMaster
+				data["user_count"] = atomic.LoadInt32(&r.numClients)
+				data["user_classes_count"] = r.reportedUserClassesCount()
 				r.client.sendChannel() <- newGenericMessage("stats", data, r.nodeID)
 				r.outputOnEevent(data)
 			case <-r.shutdownChan:
@@ -623,7 +1088,7 @@ func (r *slaveRunner) run() {
 				CPUUsage := GetCurrentCPUUsage()
 				MemUsage := GetCurrentMemUsage()
 				data := map[string]interface{}{
-					"state":                r.state,
+					"state":                r.getState(),
 					"current_cpu_usage":    CPUUsage,
 					"current_memory_usage": MemUsage,
 				}
@@ -1,8 +1,8 @@
 package boomer
 
 import (
+	"context"
 	"log"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -92,7 +92,7 @@ var _ = Describe("Test runner", func() {
 
 		runner.addWorkers(10)
 
-		currentClients := len(runner.cancelFuncs)
+		currentClients := len(runner.workers)
 		Expect(currentClients).To(BeEquivalentTo(10))
 	})
 
@@ -113,10 +113,186 @@ var _ = Describe("Test runner", func() {
 		runner.reduceWorkers(5)
 		runner.reduceWorkers(2)
 
-		currentClients := len(runner.cancelFuncs)
+		currentClients := len(runner.workers)
 		Expect(currentClients).To(BeEquivalentTo(3))
 	})
 
+	It("test distribute users", func() {
+		tasks := []*Task{
+			{Name: "A", Weight: 3},
+			{Name: "B", Weight: 1},
+		}
+
+		Expect(distributeUsers(0, tasks)).To(Equal(map[string]int{"A": 0, "B": 0}))
+		Expect(distributeUsers(1, tasks)).To(Equal(map[string]int{"A": 1, "B": 0}))
+		Expect(distributeUsers(3, tasks)).To(Equal(map[string]int{"A": 2, "B": 1}))
+		Expect(distributeUsers(4, tasks)).To(Equal(map[string]int{"A": 3, "B": 1}))
+		Expect(distributeUsers(10, tasks)).To(Equal(map[string]int{"A": 8, "B": 2}))
+		Expect(distributeUsers(100, tasks)).To(Equal(map[string]int{"A": 75, "B": 25}))
+	})
+
+	It("test distribute users to a single task with weight 0", func() {
+		runner := newLocalRunner([]*Task{{Name: "A"}}, nil, 1, 1)
+		Expect(distributeUsers(3, runner.tasks)).To(Equal(map[string]int{"A": 3}))
+	})
+
+	It("test spawn workers in user class mode", func() {
+		taskA := &Task{
+			Weight: 3,
+			Fn: func() {
+				time.Sleep(time.Second)
+			},
+			Name: "TaskA",
+		}
+		taskB := &Task{
+			Weight: 1,
+			Fn: func() {
+				time.Sleep(time.Second)
+			},
+			Name: "TaskB",
+		}
+
+		runner := newSlaveRunner("localhost", 5557, []*Task{taskA, taskB}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.userClassMode = true
+		defer runner.shutdown()
+
+		runner.spawnWorkers(8, nil)
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(8))
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"TaskA": 6, "TaskB": 2}))
+		Expect(taskA.Weight).To(Equal(3))
+
+		runner.spawnWorkers(4, nil)
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(4))
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"TaskA": 3, "TaskB": 1}))
+
+		runner.stop()
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(0))
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"TaskA": 0, "TaskB": 0}))
+	})
+
+	It("test reduce workers cancels FnCtx", func() {
+		started, cancelled := int64(0), int64(0)
+		taskA := &Task{
+			FnCtx: func(ctx context.Context) {
+				atomic.AddInt64(&started, 1)
+				<-ctx.Done()
+				atomic.AddInt64(&cancelled, 1)
+			},
+			Name: "TaskA",
+		}
+
+		runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		defer runner.shutdown()
+
+		runner.addWorkers(10)
+		Eventually(func() int64 { return atomic.LoadInt64(&started) }).Should(BeEquivalentTo(10))
+		runner.reduceWorkers(4)
+		Eventually(func() int64 { return atomic.LoadInt64(&cancelled) }).Should(BeEquivalentTo(4))
+
+		runner.reduceWorkers(6)
+		Eventually(func() int64 { return atomic.LoadInt64(&cancelled) }).Should(BeEquivalentTo(10))
+	})
+
+	It("test stop waits for running tasks in stop timeout", func() {
+		started, finished := int64(0), int64(0)
+		taskA := &Task{
+			FnCtx: func(ctx context.Context) {
+				atomic.AddInt64(&started, 1)
+				<-Stopping(ctx)
+				time.Sleep(50 * time.Millisecond)
+				Expect(ctx.Err()).To(BeNil())
+				atomic.AddInt64(&finished, 1)
+			},
+			Name: "TaskA",
+		}
+
+		runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.setStopTimeout(time.Second)
+		defer runner.shutdown()
+
+		runner.spawnWorkers(10, nil)
+		Eventually(func() int64 { return atomic.LoadInt64(&started) }).Should(BeEquivalentTo(10))
+		runner.stop()
+		Expect(atomic.LoadInt64(&finished)).To(BeEquivalentTo(10))
+		Expect(atomic.LoadInt64(&runner.forceStopped)).To(BeEquivalentTo(0))
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(0))
+	})
+
+	It("test shutdown waits for running tasks in stop timeout", func() {
+		started, finished := int64(0), int64(0)
+		taskA := &Task{
+			FnCtx: func(ctx context.Context) {
+				atomic.AddInt64(&started, 1)
+				<-Stopping(ctx)
+				time.Sleep(50 * time.Millisecond)
+				Expect(ctx.Err()).To(BeNil())
+				atomic.AddInt64(&finished, 1)
+			},
+			Name: "TaskA",
+		}
+
+		runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.setStopTimeout(time.Second)
+
+		runner.spawnWorkers(10, nil)
+		Eventually(func() int64 { return atomic.LoadInt64(&started) }).Should(BeEquivalentTo(10))
+		runner.shutdown()
+		Expect(atomic.LoadInt64(&finished)).To(BeEquivalentTo(10))
+		Expect(atomic.LoadInt64(&runner.forceStopped)).To(BeEquivalentTo(0))
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(0))
+	})
+
+	It("test stop cancels running tasks after stop timeout", func() {
+		started, cancelled := int64(0), int64(0)
+		taskA := &Task{
+			FnCtx: func(ctx context.Context) {
+				atomic.AddInt64(&started, 1)
+				<-ctx.Done()
+				atomic.AddInt64(&cancelled, 1)
+			},
+			Name: "TaskA",
+		}
+
+		runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.setStopTimeout(100 * time.Millisecond)
+		defer runner.shutdown()
+
+		runner.spawnWorkers(10, nil)
+		Eventually(func() int64 { return atomic.LoadInt64(&started) }).Should(BeEquivalentTo(10))
+		runner.reduceWorkers(4)
+		Consistently(func() int64 { return atomic.LoadInt64(&cancelled) }, 50*time.Millisecond).Should(BeEquivalentTo(0))
+		Eventually(func() int64 { return atomic.LoadInt64(&runner.forceStopped) }).Should(BeEquivalentTo(4))
+
+		runner.stop()
+		Expect(atomic.LoadInt64(&cancelled)).To(BeEquivalentTo(10))
+		Expect(atomic.LoadInt64(&runner.forceStopped)).To(BeEquivalentTo(10))
+	})
+
+	It("test stop timeout from spawn message", func() {
+		runner := newSlaveRunner("localhost", 5557, []*Task{{Name: "TaskA", Fn: func() { time.Sleep(time.Second) }}}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		defer runner.shutdown()
+
+		runner.onSpawnMessage(newGenericMessage("spawn", map[string]interface{}{
+			"timestamp":          int64(1),
+			"stop_timeout":       float64(1.5),
+			"user_classes_count": map[interface{}]interface{}{"Dummy": int64(0)},
+		}, runner.nodeID))
+		Expect(runner.getStopTimeout()).To(Equal(1500 * time.Millisecond))
+
+		runner.onSpawnMessage(newGenericMessage("spawn", map[string]interface{}{
+			"timestamp":          int64(2),
+			"stop_timeout":       nil,
+			"user_classes_count": map[interface{}]interface{}{"Dummy": int64(0)},
+		}, runner.nodeID))
+		Expect(runner.getStopTimeout()).To(Equal(1500 * time.Millisecond))
+	})
+
 	It("test localrunner", func() {
 		taskA := &Task{
 			Weight: 10,
@@ -253,14 +429,14 @@ var _ = Describe("Test runner", func() {
 		}
 
 		runner := newSlaveRunner("localhost", 5557, []*Task{taskA, taskB}, nil)
-		runner.state = stateSpawning
+		runner.setState(stateSpawning)
 		runner.client = newClient("localhost", 5557, runner.nodeID)
 		defer runner.shutdown()
 
 		runner.startSpawning(10, float64(10), runner.spawnComplete)
 		// wait for spawning goroutines
 		time.Sleep(2 * time.Second)
-		Expect(runner.numClients).To(BeEquivalentTo(10))
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(10))
 
 		msg := <-runner.client.sendChannel()
 		m := msg.(*genericMessage)
@@ -303,7 +479,7 @@ var _ = Describe("Test runner", func() {
 		}
 		runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
 		runner.client = newClient("localhost", 5557, runner.nodeID)
-		runner.state = stateInit
+		runner.setState(stateInit)
 		defer runner.shutdown()
 
 		workers, spawnRate := 0, float64(0)
@@ -319,18 +495,73 @@ var _ = Describe("Test runner", func() {
 				"Dummy":  int64(10),
 				"Dummy2": int64(10),
 			},
-			"timestamp": 1,
+			"spawn_rate": float64(5),
+			"timestamp":  1,
 		}, runner.nodeID))
 
 		Expect(workers).To(BeEquivalentTo(20))
-		Expect(spawnRate).To(BeEquivalentTo(20))
+		Expect(spawnRate).To(BeEquivalentTo(5))
 		runner.onMessage(newGenericMessage("stop", nil, runner.nodeID))
 	})
 
+	It("test on spawn message in user class mode", func() {
+		buyer := &Task{
+			Name:   "BuyerUser",
+			Weight: 1,
+			Fn: func() {
+				time.Sleep(time.Second)
+			},
+		}
+		seller := &Task{
+			Name:   "SellerUser",
+			Weight: 1,
+			Fn: func() {
+				time.Sleep(time.Second)
+			},
+		}
+		runner := newSlaveRunner("localhost", 5557, []*Task{buyer, seller}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.userClassMode = true
+		runner.setState(stateInit)
+		defer runner.shutdown()
+
+		runner.onSpawnMessage(newGenericMessage("spawn", map[string]interface{}{
+			"user_classes_count": map[interface{}]interface{}{
+				"BuyerUser":  int64(30),
+				"SellerUser": int64(10),
+				"AdminUser":  int64(5),
+			},
+			"timestamp": 1,
+		}, runner.nodeID))
+
+		msg := <-runner.client.sendChannel()
+		m := msg.(*genericMessage)
+		Expect(m.Type).To(Equal("spawning"))
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(40))
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"BuyerUser": 30, "SellerUser": 10}))
+
+		msg = <-runner.client.sendChannel()
+		m = msg.(*genericMessage)
+		Expect(m.Type).To(Equal("spawning_complete"))
+		Expect(m.Data["user_classes_count"]).To(Equal(map[string]int64{"BuyerUser": 30, "SellerUser": 10}))
+
+		// user classes without tasks of the same name fall back to weights
+		runner.onSpawnMessage(newGenericMessage("spawn", map[string]interface{}{
+			"user_classes_count": map[interface{}]interface{}{
+				"Dummy": int64(10),
+			},
+			"timestamp": 2,
+		}, runner.nodeID))
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"BuyerUser": 5, "SellerUser": 5}))
+
+		runner.stop()
+		Expect(runner.userClassesCount()).To(Equal(map[string]int64{"BuyerUser": 0, "SellerUser": 0}))
+	})
+
 	It("test onQuitMessage", func() {
 		runner := newSlaveRunner("localhost", 5557, nil, nil)
 		runner.client = newClient("localhost", 5557, "test")
-		runner.state = stateInit
+		runner.setState(stateInit)
 		defer runner.shutdown()
 
 		quitMessages := make(chan bool, 10)
@@ -343,15 +574,15 @@ var _ = Describe("Test runner", func() {
 		runner.onMessage(newGenericMessage("quit", nil, runner.nodeID))
 		Eventually(quitMessages).Should(Receive())
 
-		runner.state = stateRunning
+		runner.setState(stateRunning)
 		runner.onMessage(newGenericMessage("quit", nil, runner.nodeID))
 		Eventually(quitMessages).Should(Receive())
-		Expect(runner.state).Should(BeIdenticalTo(stateInit))
+		Expect(runner.getState()).Should(BeIdenticalTo(stateInit))
 
-		runner.state = stateStopped
+		runner.setState(stateStopped)
 		runner.onMessage(newGenericMessage("quit", nil, runner.nodeID))
 		Eventually(quitMessages).Should(Receive())
-		Expect(runner.state).Should(BeIdenticalTo(stateInit))
+		Expect(runner.getState()).Should(BeIdenticalTo(stateInit))
 	})
 
 	It("test on ack message", func() {
@@ -360,7 +591,6 @@ var _ = Describe("Test runner", func() {
 			eventCount++
 		})
 		runner := newSlaveRunner("localhost", 5557, []*Task{}, nil)
-		runner.waitForAck = sync.WaitGroup{}
 		runner.waitForAck.Add(1)
 
 		runner.onAckMessage(nil)
@@ -382,7 +612,7 @@ var _ = Describe("Test runner", func() {
 
 		runner := newSlaveRunner("localhost", 5557, []*Task{taskA, taskB}, nil)
 		runner.client = newClient("localhost", 5557, runner.nodeID)
-		runner.state = stateInit
+		runner.setState(stateInit)
 		defer runner.shutdown()
 
 		go func() {
@@ -410,8 +640,8 @@ var _ = Describe("Test runner", func() {
 		Expect(m.Type).To(Equal("spawning"))
 
 		time.Sleep(2 * time.Second)
-		Expect(runner.state).Should(BeIdenticalTo(stateRunning))
-		Expect(runner.numClients).Should(BeEquivalentTo(10))
+		Expect(runner.getState()).Should(BeIdenticalTo(stateRunning))
+		Expect(atomic.LoadInt32(&runner.numClients)).Should(BeEquivalentTo(10))
 
 		msg = <-runner.client.sendChannel()
 		m = msg.(*genericMessage)
@@ -430,8 +660,8 @@ var _ = Describe("Test runner", func() {
 		Expect(m.Type).To(Equal("spawning"))
 
 		time.Sleep(2 * time.Second)
-		Expect(runner.state).Should(BeIdenticalTo(stateRunning))
-		Expect(runner.numClients).Should(BeEquivalentTo(20))
+		Expect(runner.getState()).Should(BeIdenticalTo(stateRunning))
+		Expect(atomic.LoadInt32(&runner.numClients)).Should(BeEquivalentTo(20))
 
 		msg = <-runner.client.sendChannel()
 		m = msg.(*genericMessage)
@@ -439,7 +669,10 @@ var _ = Describe("Test runner", func() {
 
 		// stop all the workers
 		runner.onMessage(newGenericMessage("stop", nil, runner.nodeID))
-		Expect(runner.state).To(BeIdenticalTo(stateInit))
+		Expect(runner.getState()).To(BeIdenticalTo(stateStopping))
+		Eventually(runner.stopDone, 5*time.Second).Should(BeClosed())
+		runner.onStopped()
+		Expect(runner.getState()).To(BeIdenticalTo(stateInit))
 
 		msg = <-runner.client.sendChannel()
 		m = msg.(*genericMessage)
@@ -463,15 +696,18 @@ var _ = Describe("Test runner", func() {
 
 		// spawn complete and running
 		time.Sleep(2 * time.Second)
-		Expect(runner.state).Should(BeIdenticalTo(stateRunning))
-		Expect(runner.numClients).Should(BeEquivalentTo(10))
+		Expect(runner.getState()).Should(BeIdenticalTo(stateRunning))
+		Expect(atomic.LoadInt32(&runner.numClients)).Should(BeEquivalentTo(10))
 
 		msg = <-runner.client.sendChannel()
 		m = msg.(*genericMessage)
 		Expect(m.Type).To(Equal("spawning_complete"))
 		// stop all the workers
 		runner.onMessage(newGenericMessage("stop", nil, runner.nodeID))
-		Expect(runner.state).To(BeIdenticalTo(stateInit))
+		Expect(runner.getState()).To(BeIdenticalTo(stateStopping))
+		Eventually(runner.stopDone, 5*time.Second).Should(BeClosed())
+		runner.onStopped()
+		Expect(runner.getState()).To(BeIdenticalTo(stateInit))
 
 		msg = <-runner.client.sendChannel()
 		m = msg.(*genericMessage)
@@ -482,6 +718,82 @@ var _ = Describe("Test runner", func() {
 		Expect(crm.Type).To(Equal("client_ready"))
 	})
 
+	It("test on message while stopping", func() {
+		release := make(chan struct{})
+		running := make(chan struct{}, 2)
+		task := &Task{
+			Name: "Slow",
+			FnCtx: func(ctx context.Context) {
+				running <- struct{}{}
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			},
+		}
+		runner := newSlaveRunner("localhost", 5557, []*Task{task}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.setStopTimeout(10 * time.Second)
+		runner.setState(stateRunning)
+		defer runner.shutdown()
+		runner.spawnWorkers(2, nil)
+		Expect(atomic.LoadInt32(&runner.numClients)).To(BeEquivalentTo(2))
+		Eventually(running).Should(Receive())
+		Eventually(running).Should(Receive())
+
+		// the listener isn't blocked by the graceful stop
+		runner.onMessage(newGenericMessage("stop", nil, runner.nodeID))
+		Expect(runner.getState()).To(BeIdenticalTo(stateStopping))
+		runner.onMessage(newGenericMessage("heartbeat", nil, runner.nodeID))
+		Expect(runner.lastMasterHeartbeatTimestamp).NotTo(BeZero())
+		Consistently(runner.stopDone, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		// client_stopped is sent after the workers are stopped
+		close(release)
+		Eventually(runner.stopDone, 5*time.Second).Should(BeClosed())
+		runner.onStopped()
+		Expect(runner.getState()).To(BeIdenticalTo(stateInit))
+		msg := <-runner.client.sendChannel()
+		Expect(msg.(*genericMessage).Type).To(Equal("client_stopped"))
+		msg = <-runner.client.sendChannel()
+		Expect(msg.(*clientReadyMessage).Type).To(Equal("client_ready"))
+	})
+
+	It("test quit message while stopping", func() {
+		release := make(chan struct{})
+		task := &Task{
+			Name: "Slow",
+			FnCtx: func(ctx context.Context) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			},
+		}
+		runner := newSlaveRunner("localhost", 5557, []*Task{task}, nil)
+		runner.client = newClient("localhost", 5557, runner.nodeID)
+		runner.setStopTimeout(10 * time.Second)
+		runner.setState(stateRunning)
+		defer runner.shutdown()
+		runner.spawnWorkers(1, nil)
+
+		quitted := int32(0)
+		receiver := func() { atomic.StoreInt32(&quitted, 1) }
+		Events.Subscribe(EVENT_QUIT, receiver)
+		defer Events.Unsubscribe(EVENT_QUIT, receiver)
+
+		runner.onMessage(newGenericMessage("stop", nil, runner.nodeID))
+		runner.onMessage(newGenericMessage("quit", nil, runner.nodeID))
+		Expect(atomic.LoadInt32(&quitted)).To(BeEquivalentTo(1))
+		Expect(runner.getState()).To(BeIdenticalTo(stateInit))
+
+		// nothing is sent to the master after quitting
+		close(release)
+		Eventually(runner.stopDone, 5*time.Second).Should(BeClosed())
+		runner.onStopped()
+		Consistently(runner.client.sendChannel(), 100*time.Millisecond).ShouldNot(Receive())
+	})
+
 	It("test get ready", func() {
 		masterHost := "mock:127.0.0.1"
 		masterPort := 6557
@@ -0,0 +1,148 @@
+package boomer
+
+import (
+	"math"
+	"time"
+)
+
+// loadShapeTickInterval is how often the local runner polls the load shape.
+var loadShapeTickInterval = time.Second
+
+// LoadShape controls the number of users and the spawn rate over time in standalone mode,
+// like LoadTestShape in locust. It's only used by the local runner.
+type LoadShape interface {
+	// Tick is called every second with the time elapsed since the test started.
+	// It returns the number of users and the spawn rate, or done as true to stop the test.
+	Tick(runTime time.Duration) (users int, spawnRate float64, done bool)
+}
+
+// LoadShapeFunc is an adapter to allow the use of ordinary functions as load shapes.
+type LoadShapeFunc func(runTime time.Duration) (users int, spawnRate float64, done bool)
+
+// Tick calls f(runTime).
+func (f LoadShapeFunc) Tick(runTime time.Duration) (users int, spawnRate float64, done bool) {
+	return f(runTime)
+}
+
+// StepShape adds StepUsers every StepDuration, like StepLoadShape in locust.
+type StepShape struct {
+	StepUsers    int
+	StepDuration time.Duration
+	SpawnRate    float64
+	// MaxUsers limits the number of users if it's greater than 0.
+	MaxUsers int
+	// TimeLimit stops the test after it if it's greater than 0.
+	TimeLimit time.Duration
+}
+
+// Tick implements LoadShape.
+func (s *StepShape) Tick(runTime time.Duration) (int, float64, bool) {
+	if s.TimeLimit > 0 && runTime >= s.TimeLimit {
+		return 0, 0, true
+	}
+	users := s.StepUsers
+	if s.StepDuration > 0 {
+		users = int(runTime/s.StepDuration+1) * s.StepUsers
+	}
+	if s.MaxUsers > 0 && users > s.MaxUsers {
+		users = s.MaxUsers
+	}
+	return users, s.SpawnRate, false
+}
+
+// RampShape changes the number of users linearly from From to To during Duration, and stops the test after that.
+type RampShape struct {
+	From     int
+	To       int
+	Duration time.Duration
+}
+
+// Tick implements LoadShape.
+func (s *RampShape) Tick(runTime time.Duration) (int, float64, bool) {
+	if runTime >= s.Duration {
+		return 0, 0, true
+	}
+	return interpolateUsers(s.From, s.To, runTime, s.Duration), rampSpawnRate(s.From, s.To, s.Duration), false
+}
+
+// SpikeShape runs BaseUsers, and SpikeUsers from SpikeStart during SpikeDuration.
+type SpikeShape struct {
+	BaseUsers     int
+	SpikeUsers    int
+	SpikeStart    time.Duration
+	SpikeDuration time.Duration
+	SpawnRate     float64
+	// TimeLimit stops the test after it if it's greater than 0.
+	TimeLimit time.Duration
+}
+
+// Tick implements LoadShape.
+func (s *SpikeShape) Tick(runTime time.Duration) (int, float64, bool) {
+	if s.TimeLimit > 0 && runTime >= s.TimeLimit {
+		return 0, 0, true
+	}
+	if runTime >= s.SpikeStart && runTime < s.SpikeStart+s.SpikeDuration {
+		return s.SpikeUsers, s.SpawnRate, false
+	}
+	return s.BaseUsers, s.SpawnRate, false
+}
+
+// Stage is a stage of StagesShape.
+type Stage struct {
+	// Duration is the length of this stage.
+	Duration time.Duration
+	// Users is the number of users at the end of this stage,
+	// it changes linearly from the number of users at the end of the previous stage.
+	Users int
+}
+
+// StagesShape runs the stages one by one and stops the test after the last one, like stages in k6.
+// The test starts with 0 users. A stage keeping the same number of users holds the load.
+//
+// Ramp up to 100 users in 5 minutes, hold for 30 minutes and ramp down in 5 minutes:
+//
+//	&StagesShape{Stages: []Stage{
+//		{Duration: 5 * time.Minute, Users: 100},
+//		{Duration: 30 * time.Minute, Users: 100},
+//		{Duration: 5 * time.Minute, Users: 0},
+//	}}
+type StagesShape struct {
+	Stages []Stage
+	// SpawnRate is returned if it's greater than 0,
+	// otherwise, it's the rate of change of the users in the current stage.
+	SpawnRate float64
+}
+
+// Tick implements LoadShape.
+func (s *StagesShape) Tick(runTime time.Duration) (int, float64, bool) {
+	from := 0
+	for _, stage := range s.Stages {
+		if runTime < stage.Duration {
+			spawnRate := s.SpawnRate
+			if spawnRate <= 0 {
+				spawnRate = rampSpawnRate(from, stage.Users, stage.Duration)
+			}
+			return interpolateUsers(from, stage.Users, runTime, stage.Duration), spawnRate, false
+		}
+		runTime -= stage.Duration
+		from = stage.Users
+	}
+	return 0, 0, true
+}
+
+// interpolateUsers returns the number of users at elapsed during a linear change from -> to in duration.
+func interpolateUsers(from, to int, elapsed, duration time.Duration) int {
+	if duration <= 0 {
+		return to
+	}
+	return from + int(math.Round(float64(to-from)*float64(elapsed)/float64(duration)))
+}
+
+// rampSpawnRate returns the rate of change of a linear change from -> to in duration, at least 1 user per second.
+func rampSpawnRate(from, to int, duration time.Duration) float64 {
+	rate := 1.0
+	if duration > 0 {
+		rate = math.Abs(float64(to-from)) / duration.Seconds()
+	}
+	return math.Max(rate, 1)
+}
@@ -0,0 +1,90 @@
+package boomer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test load shape", func() {
+
+	type tick struct {
+		users     int
+		spawnRate float64
+		done      bool
+	}
+
+	DescribeTable("shapes", func(shape LoadShape, runTime time.Duration, expect tick) {
+		users, spawnRate, done := shape.Tick(runTime)
+		Expect(tick{users, spawnRate, done}).To(Equal(expect))
+	},
+		Entry("step first", &StepShape{StepUsers: 10, StepDuration: time.Minute, SpawnRate: 2}, 30*time.Second, tick{10, 2, false}),
+		Entry("step third", &StepShape{StepUsers: 10, StepDuration: time.Minute, SpawnRate: 2}, 150*time.Second, tick{30, 2, false}),
+		Entry("step max users", &StepShape{StepUsers: 10, StepDuration: time.Minute, MaxUsers: 25}, 10*time.Minute, tick{25, 0, false}),
+		Entry("step time limit", &StepShape{StepUsers: 10, StepDuration: time.Minute, TimeLimit: 5 * time.Minute}, 5*time.Minute, tick{0, 0, true}),
+		Entry("ramp middle", &RampShape{From: 10, To: 110, Duration: 100 * time.Second}, 50*time.Second, tick{60, 1, false}),
+		Entry("ramp done", &RampShape{From: 10, To: 110, Duration: 100 * time.Second}, 100*time.Second, tick{0, 0, true}),
+		Entry("spike before", &SpikeShape{BaseUsers: 5, SpikeUsers: 50, SpikeStart: time.Minute, SpikeDuration: time.Minute, SpawnRate: 50}, 30*time.Second, tick{5, 50, false}),
+		Entry("spike during", &SpikeShape{BaseUsers: 5, SpikeUsers: 50, SpikeStart: time.Minute, SpikeDuration: time.Minute, SpawnRate: 50}, 90*time.Second, tick{50, 50, false}),
+		Entry("spike after", &SpikeShape{BaseUsers: 5, SpikeUsers: 50, SpikeStart: time.Minute, SpikeDuration: time.Minute, SpawnRate: 50}, 2*time.Minute, tick{5, 50, false}),
+	)
+
+	stages := &StagesShape{Stages: []Stage{
+		{Duration: 10 * time.Second, Users: 100},
+		{Duration: 30 * time.Second, Users: 100},
+		{Duration: 10 * time.Second, Users: 0},
+	}}
+
+	DescribeTable("stages", func(runTime time.Duration, expect tick) {
+		users, spawnRate, done := stages.Tick(runTime)
+		Expect(tick{users, spawnRate, done}).To(Equal(expect))
+	},
+		Entry("ramp up", 5*time.Second, tick{50, 10, false}),
+		Entry("hold", 20*time.Second, tick{100, 1, false}),
+		Entry("ramp down", 45*time.Second, tick{50, 10, false}),
+		Entry("done", 50*time.Second, tick{0, 0, true}),
+	)
+
+	It("test local runner with load shape", func() {
+		interval := loadShapeTickInterval
+		loadShapeTickInterval = 10 * time.Millisecond
+		defer func() {
+			loadShapeTickInterval = interval
+		}()
+
+		taskA := &Task{
+			Weight: 10,
+			FnCtx: func(ctx context.Context) {
+				<-ctx.Done()
+			},
+			Name: "TaskA",
+		}
+		var ticks int32
+		shape := LoadShapeFunc(func(runTime time.Duration) (int, float64, bool) {
+			switch n := atomic.AddInt32(&ticks, 1); {
+			case n <= 5:
+				return 2, 200, false
+			case n <= 10:
+				return 4, 200, false
+			default:
+				return 0, 0, true
+			}
+		})
+
+		runner := newLocalRunner([]*Task{taskA}, nil, 0, 0)
+		runner.loadShape = shape
+		runner.start()
+
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&runner.numClients)
+		}).Should(BeEquivalentTo(2))
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&runner.numClients)
+		}).Should(BeEquivalentTo(4))
+		Eventually(runner.doneChan).Should(BeClosed())
+		Expect(runner.workers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,216 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// spawnStep adds or removes one worker. task is the task bound to the worker in user class mode, otherwise nil.
+type spawnStep struct {
+	task *Task
+	add  bool
+}
+
+// spawning is a spawning in progress, it's interrupted by the next spawning or stop.
+type spawning struct {
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// workerCount returns the current number of workers.
+func (r *runner) workerCount() int {
+	r.workersMutex.RLock()
+	defer r.workersMutex.RUnlock()
+
+	count := len(r.workers)
+	for _, workers := range r.userClassWorkers {
+		count += len(workers)
+	}
+	return count
+}
+
+// spawnSteps returns the steps to change the number of workers to spawnCount.
+// In user class mode, spawnCount is divided among tasks by their weights.
+func (r *runner) spawnSteps(spawnCount int) []spawnStep {
+	if r.userClassMode {
+		return r.userClassSpawnSteps(distributeUsers(spawnCount, r.tasks))
+	}
+
+	current := r.workerCount()
+	gapCount := spawnCount - current
+	step := spawnStep{add: true}
+	if gapCount < 0 {
+		gapCount = -gapCount
+		step.add = false
+	}
+	steps := make([]spawnStep, gapCount)
+	for i := range steps {
+		steps[i] = step
+	}
+	return steps
+}
+
+// userClassSpawnSteps returns the steps to change the number of workers bound to each task to userClassesCount[task.Name].
+// The steps of the tasks are interleaved in proportion, so the ratio between tasks keeps stable while spawning at a rate.
+func (r *runner) userClassSpawnSteps(userClassesCount map[string]int) []spawnStep {
+	gaps := make([]int, len(r.tasks))
+	total := 0
+	for i, task := range r.tasks {
+		gaps[i] = userClassesCount[task.Name] - r.userClassCount(task.Name)
+		if gaps[i] < 0 {
+			total -= gaps[i]
+		} else {
+			total += gaps[i]
+		}
+	}
+
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	done := make([]int, len(r.tasks))
+	steps := make([]spawnStep, 0, total)
+	for len(steps) < total {
+		next := -1
+		for i := range r.tasks {
+			if done[i] == abs(gaps[i]) {
+				continue
+			}
+			// pick the task with the least progress after this step
+			if next < 0 || (done[i]+1)*abs(gaps[next]) < (done[next]+1)*abs(gaps[i]) {
+				next = i
+			}
+		}
+		done[next]++
+		steps = append(steps, spawnStep{task: r.tasks[next], add: gaps[next] > 0})
+	}
+	return steps
+}
+
+// spawn interrupts the spawning in progress, then adds or removes workers with the steps returned by plan.
+// The workers are added or removed one by one at spawnRate per second in a new goroutine,
+// or all at once before spawn returns if spawnRate <= 0. spawnCompleteFunc is called after all the steps are done,
+// it isn't called if the spawning is interrupted.
+func (r *runner) spawn(plan func() []spawnStep, spawnRate float64, spawnCompleteFunc func()) {
+	r.spawningMutex.Lock()
+	defer r.spawningMutex.Unlock()
+
+	r.interruptSpawning()
+
+	steps := plan()
+	current := r.workerCount()
+	target := current
+	for _, step := range steps {
+		if step.add {
+			target++
+		} else {
+			target--
+		}
+	}
+	if target > current {
+		r.logger.Printf("The current number of clients is %v, %v clients will be added\n", current, target-current)
+	} else if target < current {
+		r.logger.Printf("The current number of clients is %v, %v clients will be removed\n", current, current-target)
+	}
+
+	if spawnRate <= 0 || len(steps) == 0 {
+		r.applySpawnSteps(steps, target)
+		if spawnCompleteFunc != nil {
+			go spawnCompleteFunc() //For faster time
+		}
+		return
+	}
+
+	s := &spawning{
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	r.spawning = s
+	go r.runSpawning(s, steps, target, spawnRate, spawnCompleteFunc)
+}
+
+// runSpawning applies the steps at spawnRate per second until all the steps are done,
+// the spawning is interrupted or the runner is shut down.
+func (r *runner) runSpawning(s *spawning, steps []spawnStep, target int, spawnRate float64, spawnCompleteFunc func()) {
+	defer close(s.done)
+
+	startTime := time.Now()
+	applied := 0
+	for {
+		// the first step is applied immediately, and the n-th step after (n-1)/spawnRate seconds
+		due := int(time.Since(startTime).Seconds()*spawnRate) + 1
+		if due > len(steps) {
+			due = len(steps)
+		}
+		if due > applied {
+			r.applySpawnSteps(steps[applied:due], target)
+			applied = due
+		}
+		if applied == len(steps) {
+			break
+		}
+
+		next := startTime.Add(time.Duration(float64(applied) / spawnRate * float64(time.Second)))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.cancel:
+			timer.Stop()
+			r.logger.Printf("Spawning is interrupted with %v of %v clients\n", r.workerCount(), target)
+			return
+		case <-r.shutdownChan:
+			timer.Stop()
+			return
+		}
+	}
+
+	r.logger.Printf("Spawning is complete, the current number of clients is %v\n", target)
+	if spawnCompleteFunc != nil {
+		go spawnCompleteFunc()
+	}
+}
+
+// applySpawnSteps adds and removes the workers of steps, then updates numClients and publishes EVENT_SPAWNING.
+func (r *runner) applySpawnSteps(steps []spawnStep, target int) {
+	reduce := make(map[*Task]int)
+	for _, step := range steps {
+		switch {
+		case !step.add:
+			reduce[step.task]++
+		case step.task != nil:
+			r.addUserClassWorkers(step.task, 1)
+		default:
+			r.addWorkers(1)
+		}
+	}
+	for task, count := range reduce {
+		if task != nil {
+			r.reduceUserClassWorkers(task.Name, count)
+		} else {
+			r.reduceWorkers(count)
+		}
+	}
+
+	current := r.workerCount()
+	atomic.StoreInt32(&r.numClients, int32(current))
+	Events.Publish(EVENT_SPAWNING, current, target)
+}
+
+// interruptSpawning stops the spawning in progress and waits for it to return, the caller must hold spawningMutex.
+func (r *runner) interruptSpawning() {
+	if r.spawning == nil {
+		return
+	}
+	close(r.spawning.cancel)
+	<-r.spawning.done
+	r.spawning = nil
+}
+
+// stopSpawning stops the spawning in progress, the workers already spawned are kept.
+func (r *runner) stopSpawning() {
+	r.spawningMutex.Lock()
+	defer r.spawningMutex.Unlock()
+	r.interruptSpawning()
+}
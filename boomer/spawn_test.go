@@ -0,0 +1,109 @@
+package boomer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test spawning", func() {
+
+	newTask := func(name string, weight int) *Task {
+		return &Task{
+			Name:   name,
+			Weight: weight,
+			FnCtx: func(ctx context.Context) {
+				<-Stopping(ctx)
+			},
+		}
+	}
+
+	It("test spawn at rate", func() {
+		runner := newLocalRunner([]*Task{newTask("TaskA", 1)}, nil, 0, 0)
+		defer runner.shutdown()
+
+		var mutex sync.Mutex
+		var progress [][2]int
+		handler := func(current, target int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			progress = append(progress, [2]int{current, target})
+		}
+		Events.Subscribe(EVENT_SPAWNING, handler)
+		defer Events.Unsubscribe(EVENT_SPAWNING, handler)
+
+		completed := make(chan bool, 1)
+		runner.startSpawning(4, 10, func() { completed <- true })
+		Consistently(func() int32 {
+			return atomic.LoadInt32(&runner.numClients)
+		}, 50*time.Millisecond).Should(BeNumerically("<", 3))
+		Eventually(completed).Should(Receive())
+		Expect(runner.numClients).To(BeEquivalentTo(4))
+
+		mutex.Lock()
+		Expect(progress).To(Equal([][2]int{{1, 4}, {2, 4}, {3, 4}, {4, 4}}))
+		mutex.Unlock()
+
+		// despawn at rate
+		runner.startSpawning(1, 10, func() { completed <- true })
+		Eventually(completed).Should(Receive())
+		Expect(runner.workers).To(HaveLen(1))
+	})
+
+	It("test spawn at once", func() {
+		runner := newLocalRunner([]*Task{newTask("TaskA", 1)}, nil, 0, 0)
+		defer runner.shutdown()
+
+		runner.startSpawning(10, 0, nil)
+		Expect(runner.numClients).To(BeEquivalentTo(10))
+		runner.startSpawning(2, 0, nil)
+		Expect(runner.numClients).To(BeEquivalentTo(2))
+	})
+
+	It("test interrupt spawning", func() {
+		runner := newLocalRunner([]*Task{newTask("TaskA", 1)}, nil, 0, 0)
+		defer runner.shutdown()
+
+		completed := int32(0)
+		runner.startSpawning(100, 20, func() { atomic.AddInt32(&completed, 1) })
+		time.Sleep(120 * time.Millisecond)
+
+		// the new spawning starts from the workers already spawned
+		runner.startSpawning(2, 0, nil)
+		Expect(runner.numClients).To(BeEquivalentTo(2))
+		Consistently(func() int32 {
+			return atomic.LoadInt32(&runner.numClients)
+		}, 200*time.Millisecond).Should(BeEquivalentTo(2))
+		Expect(atomic.LoadInt32(&completed)).To(BeEquivalentTo(0))
+	})
+
+	It("test stop interrupts spawning", func() {
+		runner := newLocalRunner([]*Task{newTask("TaskA", 1)}, nil, 0, 0)
+		defer runner.shutdown()
+
+		runner.startSpawning(100, 20, nil)
+		time.Sleep(60 * time.Millisecond)
+		runner.stop()
+		Consistently(func() int {
+			return runner.workerCount()
+		}, 200*time.Millisecond).Should(BeZero())
+	})
+
+	It("test interleave user classes", func() {
+		runner := newLocalRunner([]*Task{newTask("TaskA", 3), newTask("TaskB", 1)}, nil, 0, 0)
+		runner.userClassMode = true
+		defer runner.shutdown()
+
+		steps := runner.userClassSpawnSteps(map[string]int{"TaskA": 6, "TaskB": 2})
+		names := make([]string, 0, len(steps))
+		for _, step := range steps {
+			Expect(step.add).To(BeTrue())
+			names = append(names, step.task.Name)
+		}
+		Expect(names).To(Equal([]string{"TaskA", "TaskA", "TaskA", "TaskB", "TaskA", "TaskA", "TaskA", "TaskB"}))
+	})
+})
@@ -1,6 +1,7 @@
 package boomer
 
 import (
+	"sort"
 	"time"
 )
 
@@ -24,10 +25,15 @@ type requestStats struct {
 	total     *statsEntry
 	startTime int64
 
+	// accumulated stats since the test started, they are not reset after reporting
+	accumulatedEntries map[string]*statsEntry
+	accumulatedTotal   *statsEntry
+
 	requestSuccessChan  chan *requestSuccess
 	requestFailureChan  chan *requestFailure
 	clearStatsChan      chan bool
 	messageToRunnerChan chan map[string]interface{}
+	snapshotChan        chan chan *StatsSnapshot
 	shutdownChan        chan bool
 }
 
@@ -43,6 +49,7 @@ func newRequestStats() (stats *requestStats) {
 	stats.requestFailureChan = make(chan *requestFailure, 100)
 	stats.clearStatsChan = make(chan bool)
 	stats.messageToRunnerChan = make(chan map[string]interface{}, 10)
+	stats.snapshotChan = make(chan chan *StatsSnapshot)
 	stats.shutdownChan = make(chan bool)
 
 	stats.total = &statsEntry{
@@ -50,6 +57,7 @@ func newRequestStats() (stats *requestStats) {
 		Method: "",
 	}
 	stats.total.reset()
+	stats.clearAccumulated()
 
 	return stats
 }
@@ -57,11 +65,15 @@ func newRequestStats() (stats *requestStats) {
 func (s *requestStats) logRequest(method, name string, responseTime int64, contentLength int64) {
 	s.total.log(responseTime, contentLength)
 	s.get(name, method).log(responseTime, contentLength)
+	s.accumulatedTotal.log(responseTime, contentLength)
+	s.getAccumulated(name, method).log(responseTime, contentLength)
 }
 
 func (s *requestStats) logError(method, name, err string) {
 	s.total.logError(err)
 	s.get(name, method).logError(err)
+	s.accumulatedTotal.logError(err)
+	s.getAccumulated(name, method).logError(err)
 
 	// store error in errors map
 	key := MD5(method, name, err)
@@ -93,6 +105,58 @@ func (s *requestStats) get(name string, method string) (entry *statsEntry) {
 	return entry
 }
 
+func (s *requestStats) getAccumulated(name string, method string) (entry *statsEntry) {
+	entry, ok := s.accumulatedEntries[name+method]
+	if !ok {
+		entry = &statsEntry{
+			Name:   name,
+			Method: method,
+		}
+		entry.reset()
+		s.accumulatedEntries[name+method] = entry
+	}
+	return entry
+}
+
+func (s *requestStats) clearAccumulated() {
+	s.accumulatedTotal = &statsEntry{
+		Name:   "Total",
+		Method: "",
+	}
+	s.accumulatedTotal.reset()
+	s.accumulatedEntries = make(map[string]*statsEntry)
+}
+
+// snapshot returns a copy of the accumulated stats.
+func (s *requestStats) snapshot() *StatsSnapshot {
+	snapshot := &StatsSnapshot{
+		Total:   s.accumulatedTotal.snapshot(),
+		Entries: make([]*EntrySnapshot, 0, len(s.accumulatedEntries)),
+	}
+	for _, entry := range s.accumulatedEntries {
+		snapshot.Entries = append(snapshot.Entries, entry.snapshot())
+	}
+	sort.Slice(snapshot.Entries, func(i, j int) bool {
+		if snapshot.Entries[i].Name == snapshot.Entries[j].Name {
+			return snapshot.Entries[i].Method < snapshot.Entries[j].Method
+		}
+		return snapshot.Entries[i].Name < snapshot.Entries[j].Name
+	})
+	return snapshot
+}
+
+// getSnapshot asks the stats goroutine for a snapshot of the accumulated stats.
+// It returns nil if the stats goroutine is closed.
+func (s *requestStats) getSnapshot() *StatsSnapshot {
+	c := make(chan *StatsSnapshot, 1)
+	select {
+	case s.snapshotChan <- c:
+		return <-c
+	case <-s.shutdownChan:
+		return nil
+	}
+}
+
 func (s *requestStats) clearAll() {
 	s.total = &statsEntry{
 		Name:   "Total",
@@ -103,6 +167,7 @@ func (s *requestStats) clearAll() {
 	s.entries = make(map[string]*statsEntry)
 	s.errors = make(map[string]*statsError)
 	s.startTime = time.Now().Unix()
+	s.clearAccumulated()
 }
 
 func (s *requestStats) serializeStats() []interface{} {
@@ -144,6 +209,8 @@ func (s *requestStats) start() {
 				s.logError(n.requestType, n.name, n.error)
 			case <-s.clearStatsChan:
 				s.clearAll()
+			case c := <-s.snapshotChan:
+				c <- s.snapshot()
 			case <-ticker.C:
 				data := s.collectReportData()
 				// send data to channel, no network IO in this goroutine
@@ -308,6 +375,112 @@ func (s *statsEntry) getStrippedReport() map[string]interface{} {
 	return report
 }
 
+func (s *statsEntry) snapshot() *EntrySnapshot {
+	responseTimes := make(map[int64]int64, len(s.ResponseTimes))
+	for k, v := range s.ResponseTimes {
+		responseTimes[k] = v
+	}
+	return &EntrySnapshot{
+		Name:                 s.Name,
+		Method:               s.Method,
+		NumRequests:          s.NumRequests,
+		NumFailures:          s.NumFailures,
+		TotalResponseTime:    s.TotalResponseTime,
+		MinResponseTime:      s.MinResponseTime,
+		MaxResponseTime:      s.MaxResponseTime,
+		TotalContentLength:   s.TotalContentLength,
+		StartTime:            s.StartTime,
+		LastRequestTimestamp: s.LastRequestTimestamp,
+		ResponseTimes:        responseTimes,
+	}
+}
+
+// StatsSnapshot is a copy of the accumulated stats since the test started.
+type StatsSnapshot struct {
+	// The number of running users
+	UserCount int32
+	// The number of running users of each task, only available in user class mode
+	UserClassesCount map[string]int64
+	// The number of users whose running tasks are cancelled after the stop timeout
+	ForceStoppedCount int64
+	// Stats of all the requests
+	Total *EntrySnapshot
+	// Stats of each name and method, sorted by name and method
+	Entries []*EntrySnapshot
+}
+
+// Entry returns the stats of the given name and method, method is ignored if it's empty.
+// It returns nil if not found.
+func (s *StatsSnapshot) Entry(name, method string) *EntrySnapshot {
+	for _, entry := range s.Entries {
+		if entry.Name == name && (method == "" || entry.Method == method) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// EntrySnapshot is a copy of the accumulated stats of a single stats entry (name and method).
+type EntrySnapshot struct {
+	Name                 string
+	Method               string
+	NumRequests          int64
+	NumFailures          int64
+	TotalResponseTime    int64
+	MinResponseTime      int64
+	MaxResponseTime      int64
+	TotalContentLength   int64
+	StartTime            int64
+	LastRequestTimestamp int64
+	// A {response_time => count} dict, the keys are rounded like statsEntry.ResponseTimes
+	ResponseTimes map[int64]int64
+}
+
+// AvgResponseTime returns the average response time in milliseconds.
+func (e *EntrySnapshot) AvgResponseTime() float64 {
+	return getAvgResponseTime(e.NumRequests, e.TotalResponseTime)
+}
+
+// FailRatio returns the ratio of failures, from 0 to 1.
+func (e *EntrySnapshot) FailRatio() float64 {
+	return getTotalFailRatio(e.NumRequests, e.NumFailures)
+}
+
+// RPS returns the average requests per second since the first request.
+func (e *EntrySnapshot) RPS() float64 {
+	if e.NumRequests == 0 {
+		return 0
+	}
+	duration := e.LastRequestTimestamp - e.StartTime + 1
+	return float64(e.NumRequests) / float64(duration)
+}
+
+// Percentile returns the response time in milliseconds at the given percent (0 to 1),
+// using the same algorithm as locust.
+func (e *EntrySnapshot) Percentile(percent float64) int64 {
+	return getResponseTimePercentile(e.NumRequests, e.ResponseTimes, percent)
+}
+
+func getResponseTimePercentile(numRequests int64, responseTimes map[int64]int64, percent float64) int64 {
+	numOfRequest := int64(float64(numRequests) * percent)
+	sortedKeys := make([]int64, 0, len(responseTimes))
+	for k := range responseTimes {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Slice(sortedKeys, func(i, j int) bool {
+		return sortedKeys[i] > sortedKeys[j]
+	})
+
+	processedCount := int64(0)
+	for _, k := range sortedKeys {
+		processedCount += responseTimes[k]
+		if numRequests-processedCount <= numOfRequest {
+			return k
+		}
+	}
+	return 0
+}
+
 type statsError struct {
 	name        string
 	method      string
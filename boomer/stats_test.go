@@ -94,7 +94,8 @@ var _ = Describe("Test states", func() {
 		defer newStats.close()
 		newStats.logRequest("http", "success", 1, 20)
 		newStats.clearStatsChan <- true
-		Expect(newStats.total.NumRequests).To(BeEquivalentTo(0))
+		// the stats are cleared by the stats goroutine, read them from a snapshot
+		Expect(newStats.getSnapshot().Total.NumRequests).To(BeEquivalentTo(0))
 	})
 
 	It("test serialize stats", func() {
@@ -162,4 +163,40 @@ var _ = Describe("Test states", func() {
 
 		Eventually(newStats.messageToRunnerChan).WithTimeout(slaveReportInterval + 500*time.Millisecond).Should(Receive())
 	})
+
+	It("test snapshot is accumulated", func() {
+		newStats := newRequestStats()
+		newStats.logRequest("http", "success", 10, 20)
+		newStats.logRequest("http", "success", 20, 20)
+		newStats.logError("http", "success", "500 error")
+		newStats.collectReportData()
+		newStats.logRequest("http", "success", 30, 20)
+		newStats.logRequest("http", "success", 40, 20)
+
+		snapshot := newStats.snapshot()
+		Expect(snapshot.Total.NumRequests).To(BeEquivalentTo(4))
+		Expect(snapshot.Total.NumFailures).To(BeEquivalentTo(1))
+		Expect(snapshot.Entries).To(HaveLen(1))
+
+		entry := snapshot.Entry("success", "http")
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.AvgResponseTime()).To(BeEquivalentTo(25))
+		Expect(entry.FailRatio()).To(BeEquivalentTo(0.25))
+		Expect(entry.Percentile(0.5)).To(BeEquivalentTo(30))
+		Expect(entry.Percentile(0.95)).To(BeEquivalentTo(40))
+		Expect(snapshot.Entry("failure", "")).To(BeNil())
+
+		newStats.clearAll()
+		Expect(newStats.snapshot().Total.NumRequests).To(BeEquivalentTo(0))
+	})
+
+	It("test get snapshot after close", func() {
+		newStats := newRequestStats()
+		newStats.start()
+		newStats.logRequest("http", "success", 1, 20)
+		Expect(newStats.getSnapshot().Total.NumRequests).To(BeEquivalentTo(1))
+
+		newStats.close()
+		Expect(newStats.getSnapshot()).To(BeNil())
+	})
 })
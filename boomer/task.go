@@ -1,5 +1,7 @@
 package boomer
 
+import "context"
+
 // Task is like the "Locust object" in locust, the python version.
 // When boomer receives a start message from master, it will spawn several goroutines to run Task.Fn.
 // But users can keep some information in the python version, they can't do the same things in boomer.
@@ -8,6 +10,10 @@ type Task struct {
 	// The weight is used to distribute goroutines over multiple tasks.
 	Weight int
 	// Fn is called by the goroutines allocated to this task, in a loop.
-	Fn   func()
-	Name string
+	Fn func()
+	// FnCtx is like Fn, but ctx is cancelled when the goroutine is stopped, by the stop message
+	// or reducing users. If a stop timeout is set, ctx is cancelled after the timeout, and Stopping(ctx)
+	// is closed when stopping. If FnCtx is set, it's called instead of Fn.
+	FnCtx func(ctx context.Context)
+	Name  string
 }
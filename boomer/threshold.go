@@ -0,0 +1,160 @@
+package boomer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var thresholdRegexp = regexp.MustCompile(`^\s*([a-z_]+)(?:\(\s*([0-9.]+)\s*\))?\s*(<=|>=|<|>)\s*([-+0-9.eE]+)\s*$`)
+
+// Threshold is a pass/fail criterion of the stats, like thresholds in k6.
+//
+// Expr is a metric, an operator and a value, e.g. "fail_ratio < 0.01", "p(95) < 300" or "rps > 1000".
+// The metrics are:
+//
+//	fail_ratio      ratio of failures, from 0 to 1
+//	rps             average requests per second
+//	requests        number of requests
+//	failures        number of failures
+//	avg, min, max   response time in milliseconds
+//	median, p(N)    response time in milliseconds at the N-th percentile, like p(95) or p(99.9)
+//
+// The operators are <, <=, > and >=.
+type Threshold struct {
+	// Method and Name select the stats entry, e.g. "POST" and "/order". The total stats are used if Name is empty,
+	// and any method matches if Method is empty. An entry without requests is treated as zero.
+	Method string
+	Name   string
+	Expr   string
+	// Abort stops the test as soon as the threshold is breached while running.
+	// It's not checked while the stats entry has no requests yet.
+	Abort bool
+	// AbortDelay delays checking an Abort threshold after the test starts, like delayAbortEval in k6,
+	// so that a threshold like "rps > 1000" isn't breached while the users are ramping up.
+	AbortDelay time.Duration
+}
+
+// ThresholdResult is the result of a threshold.
+type ThresholdResult struct {
+	Threshold *Threshold
+	// Actual is the value of the metric.
+	Actual float64
+	Passed bool
+	// NoRequests is true if the stats entry has no requests yet.
+	NoRequests bool
+	// Err is not nil if Expr is invalid.
+	Err error
+}
+
+// String returns a line of the threshold report, e.g. "FAIL POST /order: p(95) < 300, actual 412".
+func (r ThresholdResult) String() string {
+	t := r.Threshold
+	entry := "total"
+	if t.Name != "" {
+		entry = strings.TrimSpace(t.Method + " " + t.Name)
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("FAIL %s: %v", entry, r.Err)
+	}
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("%s %s: %s, actual %s", status, entry, strings.TrimSpace(t.Expr), strconv.FormatFloat(r.Actual, 'f', -1, 64))
+}
+
+// Validate returns an error if Expr is invalid.
+func (t *Threshold) Validate() error {
+	_, _, _, err := t.parse()
+	return err
+}
+
+// parse parses Expr, it returns a function to get the metric from the entry.
+func (t *Threshold) parse() (metric func(e *EntrySnapshot) float64, op string, value float64, err error) {
+	matches := thresholdRegexp.FindStringSubmatch(t.Expr)
+	if matches == nil {
+		return nil, "", 0, fmt.Errorf("invalid threshold %q", t.Expr)
+	}
+	name, arg, op := matches[1], matches[2], matches[3]
+	value, err = strconv.ParseFloat(matches[4], 64)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("invalid value of threshold %q", t.Expr)
+	}
+	if (name == "p") != (arg != "") {
+		return nil, "", 0, fmt.Errorf("invalid metric of threshold %q", t.Expr)
+	}
+
+	switch name {
+	case "fail_ratio":
+		metric = (*EntrySnapshot).FailRatio
+	case "rps":
+		metric = (*EntrySnapshot).RPS
+	case "requests":
+		metric = func(e *EntrySnapshot) float64 { return float64(e.NumRequests) }
+	case "failures":
+		metric = func(e *EntrySnapshot) float64 { return float64(e.NumFailures) }
+	case "avg":
+		metric = (*EntrySnapshot).AvgResponseTime
+	case "min":
+		metric = func(e *EntrySnapshot) float64 { return float64(e.MinResponseTime) }
+	case "max":
+		metric = func(e *EntrySnapshot) float64 { return float64(e.MaxResponseTime) }
+	case "median":
+		metric = func(e *EntrySnapshot) float64 { return float64(e.Percentile(0.5)) }
+	case "p":
+		percent, err := strconv.ParseFloat(arg, 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, "", 0, fmt.Errorf("invalid percentile of threshold %q", t.Expr)
+		}
+		metric = func(e *EntrySnapshot) float64 { return float64(e.Percentile(percent / 100)) }
+	default:
+		return nil, "", 0, fmt.Errorf("unknown metric %s of threshold %q", name, t.Expr)
+	}
+	return metric, op, value, nil
+}
+
+// Evaluate evaluates the threshold with the stats.
+func (t *Threshold) Evaluate(snapshot *StatsSnapshot) ThresholdResult {
+	metric, op, value, err := t.parse()
+	if err != nil {
+		return ThresholdResult{Threshold: t, Err: err}
+	}
+
+	entry := &EntrySnapshot{}
+	if snapshot != nil {
+		if t.Name == "" && snapshot.Total != nil {
+			entry = snapshot.Total
+		} else if e := snapshot.Entry(t.Name, t.Method); t.Name != "" && e != nil {
+			entry = e
+		}
+	}
+
+	actual := metric(entry)
+	result := ThresholdResult{Threshold: t, Actual: actual, NoRequests: entry.NumRequests == 0}
+	switch op {
+	case "<":
+		result.Passed = actual < value
+	case "<=":
+		result.Passed = actual <= value
+	case ">":
+		result.Passed = actual > value
+	case ">=":
+		result.Passed = actual >= value
+	}
+	return result
+}
+
+// EvaluateThresholds evaluates the thresholds with the stats, passed is true if all of them are passed.
+func EvaluateThresholds(snapshot *StatsSnapshot, thresholds []*Threshold) (results []ThresholdResult, passed bool) {
+	passed = true
+	results = make([]ThresholdResult, 0, len(thresholds))
+	for _, t := range thresholds {
+		result := t.Evaluate(snapshot)
+		passed = passed && result.Passed
+		results = append(results, result)
+	}
+	return results, passed
+}
@@ -0,0 +1,74 @@
+package boomer
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test threshold", func() {
+
+	snapshot := &StatsSnapshot{
+		Total: &EntrySnapshot{
+			NumRequests:          200,
+			NumFailures:          4,
+			TotalResponseTime:    20000,
+			MinResponseTime:      10,
+			MaxResponseTime:      500,
+			StartTime:            100,
+			LastRequestTimestamp: 109,
+			ResponseTimes:        map[int64]int64{50: 100, 100: 90, 400: 10},
+		},
+		Entries: []*EntrySnapshot{
+			{Name: "/order", Method: "POST", NumRequests: 100, ResponseTimes: map[int64]int64{100: 90, 400: 10}},
+			{Name: "/order", Method: "GET", NumRequests: 100, ResponseTimes: map[int64]int64{50: 100}},
+		},
+	}
+
+	DescribeTable("evaluate", func(t *Threshold, actual float64, passed bool) {
+		result := t.Evaluate(snapshot)
+		Expect(result.Err).NotTo(HaveOccurred())
+		Expect(result.Actual).To(BeNumerically("~", actual, 0.0001))
+		Expect(result.Passed).To(Equal(passed))
+	},
+		Entry("fail ratio", &Threshold{Expr: "fail_ratio < 0.01"}, 0.02, false),
+		Entry("rps", &Threshold{Expr: "rps >= 20"}, 20.0, true),
+		Entry("requests", &Threshold{Expr: "requests > 100"}, 200.0, true),
+		Entry("failures", &Threshold{Expr: "failures <= 4"}, 4.0, true),
+		Entry("avg", &Threshold{Expr: "avg<100"}, 100.0, false),
+		Entry("max", &Threshold{Expr: "max < 1000"}, 500.0, true),
+		Entry("median", &Threshold{Expr: "median <= 100"}, 100.0, true),
+		Entry("percentile of entry", &Threshold{Method: "POST", Name: "/order", Expr: "p(95) < 300"}, 400.0, false),
+		Entry("percentile of another method", &Threshold{Method: "GET", Name: "/order", Expr: "p(99.9) < 300"}, 50.0, true),
+		Entry("entry without requests", &Threshold{Name: "/pay", Expr: "rps > 10"}, 0.0, false),
+	)
+
+	DescribeTable("invalid", func(expr string) {
+		t := &Threshold{Expr: expr}
+		Expect(t.Validate()).To(HaveOccurred())
+		result := t.Evaluate(snapshot)
+		Expect(result.Passed).To(BeFalse())
+		Expect(result.String()).To(HavePrefix("FAIL total: "))
+	},
+		Entry("unknown metric", "p95 < 300"),
+		Entry("no operator", "rps 1000"),
+		Entry("percentile out of range", "p(101) < 300"),
+		Entry("percentile of other metric", "avg(95) < 300"),
+	)
+
+	It("test evaluate thresholds", func() {
+		results, passed := EvaluateThresholds(snapshot, []*Threshold{
+			{Expr: "fail_ratio < 0.05"},
+			{Method: "POST", Name: "/order", Expr: "p(95) < 300"},
+		})
+		Expect(passed).To(BeFalse())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].String()).To(Equal("PASS total: fail_ratio < 0.05, actual 0.02"))
+		Expect(results[1].String()).To(Equal("FAIL POST /order: p(95) < 300, actual 400"))
+
+		Expect(results[0].NoRequests).To(BeFalse())
+
+		results, passed = EvaluateThresholds(nil, []*Threshold{{Expr: "failures < 1"}})
+		Expect(passed).To(BeTrue())
+		Expect(results[0].NoRequests).To(BeTrue())
+	})
+})
@@ -29,6 +29,19 @@ func castToInt64(num interface{}) (ret int64, ok bool) {
 	return int64(0), false
 }
 
+func castToFloat64(num interface{}) (ret float64, ok bool) {
+	switch n := num.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if n, ok := castToInt64(num); ok {
+		return float64(n), true
+	}
+	return float64(0), false
+}
+
 func round(val float64, roundOn float64, places int) (newVal float64) {
 	var round float64
 	pow := math.Pow(10, float64(places))
@@ -21,6 +21,17 @@ var _ = Describe("Test utils", func() {
 		Entry("int32", int32(10), int64(0), false),
 	)
 
+	DescribeTable("cast to float64", func(value interface{}, expect float64, ok bool) {
+		result, o := castToFloat64(value)
+		Expect(o).To(Equal(ok))
+		Expect(result).To(BeEquivalentTo(expect))
+	},
+		Entry("float64", float64(1.5), float64(1.5), true),
+		Entry("float32", float32(1.5), float64(1.5), true),
+		Entry("int64", int64(10), float64(10), true),
+		Entry("nil", nil, float64(0), false),
+	)
+
 	DescribeTable("test round", func(value float64, roundOn float64, places int, expect float64) {
 		result := round(value, roundOn, places)
 		Expect(result).To(Equal(expect))
@@ -0,0 +1,234 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:04
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"github.com/Hellowlonewolf/navigator/boomer"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrLeadRunning    = errors.New("lead is running")
+	ErrLeadNotRunning = errors.New("lead is not running")
+	ErrNoLine         = errors.New("no line registered")
+)
+
+// leadRun Start 启动的一次压测
+type leadRun struct {
+	boomer     *boomer.Boomer
+	limit      *runLimit
+	arrival    *arrivalExecutor
+	thresholds *thresholdWatcher
+	// onQuit master 下发退出指令时结束本次压测
+	onQuit func()
+	// last 压测结束时的统计数据，done 关闭后可读
+	last     *boomer.StatsSnapshot
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Start 非阻塞地启动压测任务，不解析命令行参数，也不监听系统信号，
+// 便于在 Go 程序中通过 Scale、Stop、Wait、Stats 在同一进程内驱动多个压测阶段。
+// 虚拟用户需事先通过 Register 或 ResetLine 设置。
+// 通过 BoomerClient 设置了 boomer 时使用该 boomer（单机或分布式模式均可），
+// 否则创建一个初始用户数为 0 的单机模式 boomer，需调用 Scale 设置用户数。
+// ctx 取消、调用 Stop 或 master 下发退出指令时压测结束，结束后可再次调用 Start。
+func (l *Lead) Start(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.current != nil {
+		select {
+		case <-l.current.done:
+		default:
+			return ErrLeadRunning
+		}
+	}
+	if len(l.lines) == 0 {
+		return ErrNoLine
+	}
+
+	b := l.option.boomerClient
+	if b == nil {
+		b = boomer.NewStandaloneBoomer(0, 0)
+	}
+	run := &leadRun{
+		boomer: b,
+		done:   make(chan struct{}),
+	}
+	// 设置了 Abort 的阈值未通过时结束本次压测
+	thresholds, err := newThresholdWatcher(l.option.thresholds, b.Stats, func() {
+		l.stop(run)
+	})
+	if err != nil {
+		return err
+	}
+	run.thresholds = thresholds
+	// 达到 Duration 或 SharedIterations 时结束本次压测
+	run.limit, err = newRunLimit(l.option, func() {
+		l.stop(run)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := l.startTest(ctx); err != nil {
+		return err
+	}
+
+	// master 下发退出指令时结束本次压测，Stop 中会再次发布退出事件，因此异步处理
+	run.onQuit = func() {
+		go l.stop(run)
+	}
+	if err := Events.SubscribeOnce(EventQuit, run.onQuit); err != nil {
+		return l.abortStart(run, err)
+	}
+
+	b.EnableUserClassMode()
+	if l.option.stopTimeout > 0 {
+		b.SetStopTimeout(l.option.stopTimeout)
+	}
+	if l.option.loadShape != nil {
+		b.SetLoadShape(l.option.loadShape)
+	}
+	var tasks []*boomer.Task
+	var classes []*userClass
+	if l.option.arrivalRate != nil {
+		// 开放模型的虚拟用户由 arrivalExecutor 创建，boomer 仅用于统计
+		classes = l.userClasses()
+		run.arrival = newArrivalExecutor(l, l.option.arrivalRate)
+	} else {
+		tasks = l.userClassTasks()
+	}
+
+	if err := run.limit.start(); err != nil {
+		return l.abortStart(run, err)
+	}
+
+	l.limit = run.limit
+	l.thresholds = thresholds
+	l.current = run
+	leadutil.RecordFailure = b.RecordFailure
+	leadutil.RecordSuccess = b.RecordSuccess
+	b.Start(tasks...)
+	if run.arrival != nil {
+		run.arrival.start(classes, l.option.arrivalRate.preAllocatedUsers)
+	}
+	run.thresholds.start()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.stop(run)
+		case <-run.done:
+		}
+	}()
+
+	return nil
+}
+
+// abortStart Start 失败时清理已执行的部分：取消订阅、执行 OnTestStop，返回 err。
+// 此时 l.current 尚未设置，之后可再次调用 Start。
+func (l *Lead) abortStart(run *leadRun, err error) error {
+	run.stopOnce.Do(func() {
+		run.limit.close()
+		_ = Events.Unsubscribe(EventQuit, run.onQuit)
+		l.stopTest(context.Background())
+		close(run.done)
+	})
+	return err
+}
+
+// Scale 调整虚拟用户数量及每秒启动的用户数，仅支持单机模式，分布式模式下用户数量由 master 控制。
+func (l *Lead) Scale(users int, rate float64) error {
+	run := l.running()
+	if run == nil {
+		return ErrLeadNotRunning
+	}
+	if run.arrival != nil {
+		return ErrArrivalRateScale
+	}
+	return run.boomer.Scale(users, rate)
+}
+
+// Stop 停止 Start 启动的压测任务，未启动时直接返回。
+func (l *Lead) Stop() {
+	l.mutex.Lock()
+	run := l.current
+	l.mutex.Unlock()
+	if run == nil {
+		return
+	}
+	l.stop(run)
+}
+
+func (l *Lead) stop(run *leadRun) {
+	run.stopOnce.Do(func() {
+		run.limit.close()
+		if run.arrival != nil {
+			run.arrival.stop(l.option.stopTimeout)
+		}
+		// 结束前使用最后的统计数据检查阈值，boomer 退出后统计数据不可用
+		run.thresholds.stop()
+		run.last = run.boomer.Stats()
+		run.boomer.Quit()
+		l.stopTest(context.Background())
+		close(run.done)
+	})
+}
+
+// Wait 等待 Start 启动的压测任务结束，未启动时直接返回。
+func (l *Lead) Wait() {
+	l.mutex.Lock()
+	run := l.current
+	l.mutex.Unlock()
+	if run == nil {
+		return
+	}
+	<-run.done
+}
+
+// Stats 获取 Start 启动以来的累计统计数据，压测结束后返回结束时的统计数据，便于在 Wait 后读取每个阶段的结果，
+// 未启动时返回 nil。
+func (l *Lead) Stats() *boomer.StatsSnapshot {
+	l.mutex.Lock()
+	run := l.current
+	l.mutex.Unlock()
+	if run == nil {
+		return nil
+	}
+	select {
+	case <-run.done:
+		return run.last
+	default:
+		return run.boomer.Stats()
+	}
+}
+
+// ActiveUsers 已创建、尚未执行完 OnFinish 的虚拟用户数，
+// 被停止或缩容的虚拟用户在执行完 OnFinish 后不再计入。
+func (l *Lead) ActiveUsers() int64 {
+	return atomic.LoadInt64(&l.activeUsers)
+}
+
+// running 获取运行中的压测，未运行时返回 nil
+func (l *Lead) running() *leadRun {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.current == nil {
+		return nil
+	}
+	select {
+	case <-l.current.done:
+		return nil
+	default:
+		return l.current
+	}
+}
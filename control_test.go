@@ -0,0 +1,236 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:04
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pingLine 测试用的虚拟用户，每次任务记录一条 /ping 的成功数据
+type pingLine struct {
+	*Line
+	finished *int64
+}
+
+func newPingLine(finished *int64) func() ILine {
+	return func() ILine {
+		l := &pingLine{Line: NewLine(), finished: finished}
+		l.AddWeightFunc(l.Ping, 1)
+		return l
+	}
+}
+
+func (l *pingLine) Ping() {
+	leadutil.RecordSuccess("http", "/ping", 1, 10)
+}
+
+func (l *pingLine) OnFinish() {
+	atomic.AddInt64(l.finished, 1)
+}
+
+// waitFor 等待 cond 成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeadStartScaleStopWait(t *testing.T) {
+	var finished int64
+	l := New(Interval("10ms"))
+
+	if err := l.Start(context.Background()); !errors.Is(err, ErrNoLine) {
+		t.Fatalf("Start() without lines = %v, want %v", err, ErrNoLine)
+	}
+	if err := l.Scale(1, 0); !errors.Is(err, ErrLeadNotRunning) {
+		t.Fatalf("Scale() before Start = %v, want %v", err, ErrLeadNotRunning)
+	}
+	if l.Stats() != nil {
+		t.Fatal("Stats() before Start should be nil")
+	}
+	// 未启动时直接返回
+	l.Stop()
+	l.Wait()
+
+	l.ResetLine(newPingLine(&finished))
+	for phase := 1; phase <= 2; phase++ {
+		atomic.StoreInt64(&finished, 0)
+		if err := l.Start(context.Background()); err != nil {
+			t.Fatalf("phase %d: Start() = %v", phase, err)
+		}
+		if err := l.Start(context.Background()); !errors.Is(err, ErrLeadRunning) {
+			t.Fatalf("phase %d: Start() while running = %v, want %v", phase, err, ErrLeadRunning)
+		}
+
+		if err := l.Scale(3, 0); err != nil {
+			t.Fatalf("phase %d: Scale() = %v", phase, err)
+		}
+		waitFor(t, "3 active users", func() bool { return l.ActiveUsers() == 3 })
+		waitFor(t, "requests", func() bool {
+			stats := l.Stats()
+			return stats != nil && stats.Total.NumRequests > 0
+		})
+		if err := l.Scale(1, 0); err != nil {
+			t.Fatalf("phase %d: Scale() = %v", phase, err)
+		}
+		waitFor(t, "1 active user", func() bool { return l.ActiveUsers() == 1 })
+
+		l.Stop()
+		l.Wait()
+		if n := l.ActiveUsers(); n != 0 {
+			t.Fatalf("phase %d: ActiveUsers() after Stop = %d", phase, n)
+		}
+		if n := atomic.LoadInt64(&finished); n != 3 {
+			t.Fatalf("phase %d: OnFinish called %d times, want 3", phase, n)
+		}
+		// 结束后仍可读取本阶段的统计数据
+		stats := l.Stats()
+		if stats == nil || stats.Entry("/ping", "http") == nil || stats.Entry("/ping", "http").NumRequests == 0 {
+			t.Fatalf("phase %d: Stats() after Wait = %v", phase, stats)
+		}
+		if err := l.Scale(1, 0); !errors.Is(err, ErrLeadNotRunning) {
+			t.Fatalf("phase %d: Scale() after Stop = %v, want %v", phase, err, ErrLeadNotRunning)
+		}
+	}
+}
+
+func TestLeadStartCanceled(t *testing.T) {
+	var finished int64
+	l := New(Interval("10ms"))
+	l.ResetLine(newPingLine(&finished))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Scale(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "2 active users", func() bool { return l.ActiveUsers() == 2 })
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		l.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() does not return after ctx is canceled")
+	}
+	if n := atomic.LoadInt64(&finished); n != 2 {
+		t.Fatalf("OnFinish called %d times, want 2", n)
+	}
+}
+
+func TestLeadStartFailed(t *testing.T) {
+	var finished int64
+	var stops int
+	l := New(Interval("10ms"))
+	l.ResetLine(newPingLine(&finished))
+	errStart := errors.New("no tenant")
+	l.OnTestStart(func(ctx context.Context) (interface{}, error) {
+		return nil, errStart
+	})
+	l.OnTestStop(func(ctx context.Context, fixture interface{}) error {
+		stops++
+		return nil
+	})
+
+	if err := l.Start(context.Background()); !errors.Is(err, errStart) {
+		t.Fatalf("Start() = %v, want %v", err, errStart)
+	}
+	if stops != 0 {
+		t.Fatal("OnTestStop should not be called when OnTestStart fails")
+	}
+
+	// Start 中途失败时清理已执行的部分，之后可再次启动
+	l.OnTestStart(nil)
+	run := &leadRun{done: make(chan struct{})}
+	errSubscribe := errors.New("subscribe failed")
+	if err := l.abortStart(run, errSubscribe); !errors.Is(err, errSubscribe) {
+		t.Fatalf("abortStart() = %v, want %v", err, errSubscribe)
+	}
+	if stops != 1 {
+		t.Fatalf("OnTestStop called %d times, want 1", stops)
+	}
+	select {
+	case <-run.done:
+	default:
+		t.Fatal("run is not done after abortStart")
+	}
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatalf("Start() after a failed Start = %v", err)
+	}
+	l.Stop()
+	l.Wait()
+	if stops != 2 {
+		t.Fatalf("OnTestStop called %d times, want 2", stops)
+	}
+}
+
+func TestLeadUserClassesDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		users   int
+		want    map[string]int64
+	}{
+		{
+			name:    "weighted",
+			weights: []int{3, 1},
+			users:   8,
+			want:    map[string]int64{"weightLine": 6, "weightLine2": 2},
+		},
+		{
+			name:    "single class with weight 0",
+			weights: []int{0},
+			users:   3,
+			want:    map[string]int64{"weightLine": 3},
+		},
+		{
+			name:    "weight 0 counts as 1",
+			weights: []int{0, 1},
+			users:   4,
+			want:    map[string]int64{"weightLine": 2, "weightLine2": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(Interval("10ms"))
+			for _, weight := range tt.weights {
+				l.lines = append(l.lines, &lineClass{newLine: newWeightLine(weight)})
+			}
+			if err := l.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				l.Stop()
+				l.Wait()
+			}()
+
+			if err := l.Scale(tt.users, 0); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "all users", func() bool { return l.ActiveUsers() == int64(tt.users) })
+			if got := l.Stats().UserClassesCount; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("UserClassesCount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"io"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var debugFlag = flag.Bool("debug", false, "run each user once locally without connecting to the master, exit with status 1 on failures")
+var debugIterations = flag.Int("debug_iterations", 10, "number of tasks each user runs with --debug")
+
+// ErrDebugFailed 调试模式下有任务失败、panic 或请求失败
+var ErrDebugFailed = errors.New("debug run failed")
+
+// debugMode 是否使用 --debug 调试运行，--debug_mode 只控制 DebugMode，不影响 Run
+func debugMode() bool {
+	return *debugFlag
+}
+
+// Debug 调试运行虚拟用户，不连接 master。
+// 每类虚拟用户创建一个虚拟用户，依次执行 OnStart、DebugIterations（默认 --debug_iterations）次任务与 OnFinish，
+// 任务之间不等待，输出每个任务的耗时、记录的请求成功与失败数据，以及虚拟用户的 leadutil.Map 数据。
+// 有任务失败、panic 或请求失败时返回 ErrDebugFailed。
+// 使用 --debug 运行时，Run 调用 Debug，失败时以状态码1退出，可以作为 CI 的冒烟测试。
+func (l *Lead) Debug(ls ...func() ILine) error {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	for _, fn := range ls {
+		l.lines = append(l.lines, &lineClass{newLine: fn})
+	}
+	if len(l.lines) == 0 {
+		return ErrNoLine
+	}
+
+	iterations := l.option.debugIterations
+	if iterations <= 0 {
+		iterations = *debugIterations
+	}
+	d := &debugRunner{lead: l, out: os.Stdout, iterations: iterations}
+	return d.run()
+}
+
+// debugRunner 调试运行虚拟用户，记录失败数量
+type debugRunner struct {
+	lead       *Lead
+	out        io.Writer
+	iterations int
+
+	mutex          sync.Mutex
+	tasks          int
+	failedTasks    int
+	failedRequests int
+}
+
+func (d *debugRunner) printf(format string, a ...interface{}) {
+	fmt.Fprintf(d.out, "[debug] "+format+"\n", a...)
+}
+
+func (d *debugRunner) run() error {
+	recordSuccess, recordFailure := leadutil.RecordSuccess, leadutil.RecordFailure
+	defer func() {
+		leadutil.RecordSuccess, leadutil.RecordFailure = recordSuccess, recordFailure
+	}()
+	leadutil.RecordSuccess = d.recordSuccess
+	leadutil.RecordFailure = d.recordFailure
+
+	d.lead.tagFilter = newTagFilter(d.lead.option)
+	if d.lead.testStart != nil {
+		err := d.call("OnTestStart", func() error {
+			return d.lead.startTest(context.Background())
+		})
+		if err != nil {
+			return fmt.Errorf("%w: OnTestStart: %v", ErrDebugFailed, err)
+		}
+	}
+	for _, class := range d.lead.lines {
+		d.runLine(class)
+	}
+	if d.lead.testStop != nil {
+		_ = d.call("OnTestStop", func() error {
+			return d.lead.testStop(context.Background(), d.lead.fixture)
+		})
+	}
+
+	d.printf("%d tasks, %d failed tasks, %d failed requests", d.tasks, d.failedTasks, d.failedRequests)
+	if d.failedTasks > 0 || d.failedRequests > 0 {
+		return fmt.Errorf("%w: %d failed tasks, %d failed requests", ErrDebugFailed, d.failedTasks, d.failedRequests)
+	}
+	return nil
+}
+
+func (d *debugRunner) recordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	d.printf("    success %s %s %dms %dB", requestType, name, responseTime, responseLength)
+}
+
+func (d *debugRunner) recordFailure(requestType, name string, responseTime int64, exception string) {
+	d.mutex.Lock()
+	d.failedRequests++
+	d.mutex.Unlock()
+	d.printf("    failure %s %s %dms: %s", requestType, name, responseTime, exception)
+}
+
+// fail 记录任务失败
+func (d *debugRunner) fail(step string, elapsed time.Duration, err error) {
+	d.mutex.Lock()
+	d.failedTasks++
+	d.mutex.Unlock()
+	d.printf("%s FAIL %v: %v", step, elapsed, err)
+}
+
+// call 执行 OnStartInit、OnStart 等函数，panic 时返回错误
+func (d *debugRunner) call(step string, fn func() error) (err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+		switch {
+		case errors.Is(err, leadutil.ErrFeederStop):
+		case err != nil:
+			d.fail(step, time.Since(start), err)
+		default:
+			d.printf("%s ok %v", step, time.Since(start))
+		}
+	}()
+	return fn()
+}
+
+// runLine 运行一个虚拟用户，流程同 forFn
+func (d *debugRunner) runLine(class *lineClass) {
+	l := d.lead
+
+	var user Liner
+	var newUser ILine
+	err := d.call("OnStartInit", func() error {
+		prototype := class.newLine()
+		l.inject(prototype)
+		if err := prototype.OnStartInit(); err != nil {
+			return err
+		}
+		newUser = class.newLine()
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	name := class.name
+	if name == "" {
+		name = lineName(newUser)
+	}
+	d.printf("user %s", name)
+
+	var ok bool
+	if user, ok = newUser.(Liner); !ok {
+		user = &wrapLine{newUser}
+	}
+	l.inject(newUser)
+	l.tagFilter.apply(user)
+	user.Init()
+
+	defer func() {
+		_ = d.call("OnFinish", func() error {
+			defer ReleaseHeld(user)
+			user.OnFinish()
+			return nil
+		})
+		d.printMaps(newUser)
+		if data, err := l.store.Snapshot(); err == nil && l.store.Len() > 0 {
+			d.printf("Store = %s", data)
+		}
+	}()
+
+	err = d.call("OnStart", user.OnStart)
+	if errors.Is(err, leadutil.ErrFeederStop) {
+		d.printf("user interrupt: %v", err)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	handler := l.taskHandler(newUser, l.option.taskTimeout)
+	for i := 1; i <= d.iterations; i++ {
+		if !d.iterate(i, user, newUser, handler) {
+			return
+		}
+	}
+}
+
+// iterate 执行第 i 次任务，返回是否继续执行。
+// 任务或中间件 panic 时记录为失败的任务并结束该虚拟用户，同 forFn
+func (d *debugRunner) iterate(i int, user Liner, line ILine, handler TaskHandler) (next bool) {
+	step := fmt.Sprintf("#%d", i)
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			d.fail(step, time.Since(start), fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+			next = false
+		}
+	}()
+
+	task := user.Next()
+	if task == nil {
+		if user.Status() != StatusInterrupt {
+			d.fail(step, 0, errors.New("next task not found"))
+		}
+		return false
+	}
+
+	// 任务中记录的请求数据输出在任务名与执行结果之间
+	tc := &TaskContext{Ctx: context.Background(), Task: task, Line: line}
+	d.printf("%s task %s", step, taskStatsName(task.Name))
+	d.tasks++
+	start = time.Now()
+	handler(tc)
+	elapsed := time.Since(start)
+
+	if tc.Err != nil {
+		d.fail(step, elapsed, tc.Err)
+	} else {
+		d.printf("%s ok %v", step, elapsed)
+	}
+
+	switch user.Status() {
+	case StatusInterrupt:
+		d.printf("user interrupt after %d tasks", i)
+		return false
+	case StatusSkip:
+		user.ChangeStatus(StatusNormal)
+	}
+	return true
+}
+
+// printMaps 输出虚拟用户中 leadutil.Map 类型的导出字段，包括匿名嵌入结构体中的字段
+func (d *debugRunner) printMaps(line ILine) {
+	v := reflect.ValueOf(line)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	mapType := reflect.TypeOf(leadutil.Map{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		var m *leadutil.Map
+		switch {
+		case field.Type == mapType && fv.CanAddr():
+			m = fv.Addr().Interface().(*leadutil.Map)
+		case field.Type == reflect.PtrTo(mapType) && !fv.IsNil():
+			m = fv.Interface().(*leadutil.Map)
+		case field.Anonymous:
+			if line, ok := fv.Interface().(ILine); ok {
+				d.printMaps(line)
+			}
+			continue
+		default:
+			continue
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		d.printf("%s = %s", field.Name, data)
+	}
+}
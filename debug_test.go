@@ -0,0 +1,210 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"strings"
+	"testing"
+)
+
+// debugLine 测试调试模式的虚拟用户，各阶段的行为由字段控制
+type debugLine struct {
+	*Line
+	Data leadutil.Map
+
+	startErr error
+	task     func(l *debugLine)
+	finished *int
+}
+
+func (l *debugLine) OnStart() error {
+	return l.startErr
+}
+
+func (l *debugLine) OnFinish() {
+	*l.finished++
+}
+
+func (l *debugLine) Order() {
+	l.task(l)
+}
+
+func TestDebugRunner(t *testing.T) {
+	tests := []struct {
+		name       string
+		startErr   error
+		task       func(l *debugLine)
+		build      func(l *debugLine)
+		middleware Middleware
+		iterations int
+		tasks      int
+		failed     bool
+		output     []string
+	}{
+		{
+			name:       "ok",
+			task:       func(l *debugLine) { leadutil.RecordSuccess("http", "/order", 1, 10) },
+			iterations: 3,
+			tasks:      3,
+			output:     []string{"user debugLine", "#1 task navigator.(*debugLine).Order", "success http /order", "#3 ok", "3 tasks, 0 failed tasks, 0 failed requests", "Data = "},
+		},
+		{
+			name:       "task failed",
+			task:       func(l *debugLine) { l.Fail(errors.New("out of stock")) },
+			iterations: 2,
+			tasks:      2,
+			failed:     true,
+			output:     []string{"#1 FAIL", "out of stock", "2 tasks, 2 failed tasks, 0 failed requests"},
+		},
+		{
+			name:       "task panic",
+			task:       func(l *debugLine) { panic("boom") },
+			iterations: 1,
+			tasks:      1,
+			failed:     true,
+			output:     []string{"#1 FAIL", "boom"},
+		},
+		{
+			name:       "request failed",
+			task:       func(l *debugLine) { leadutil.RecordFailure("http", "/order", 1, "500") },
+			iterations: 2,
+			tasks:      2,
+			failed:     true,
+			output:     []string{"failure http /order 1ms: 500", "2 tasks, 0 failed tasks, 2 failed requests"},
+		},
+		{
+			name:       "OnStart failed",
+			startErr:   errors.New("login failed"),
+			task:       func(l *debugLine) {},
+			iterations: 2,
+			failed:     true,
+			output:     []string{"OnStart FAIL", "login failed", "OnFinish ok"},
+		},
+		{
+			name:       "feeder stopped",
+			startErr:   leadutil.ErrFeederStop,
+			task:       func(l *debugLine) {},
+			iterations: 2,
+			output:     []string{"user interrupt", "0 tasks, 0 failed tasks, 0 failed requests"},
+		},
+		{
+			name:       "task without panic protection panics",
+			build:      func(l *debugLine) { l.AddTask(&Task{Name: "raw", Fn: func() { panic("boom") }, Weight: 1}) },
+			iterations: 3,
+			tasks:      1,
+			failed:     true,
+			output:     []string{"#1 task raw", "#1 FAIL", "panic: boom", "1 tasks, 1 failed tasks, 0 failed requests", "OnFinish ok"},
+		},
+		{
+			name: "middleware panics",
+			task: func(l *debugLine) {},
+			middleware: func(next TaskHandler) TaskHandler {
+				return func(tc *TaskContext) { panic("middleware boom") }
+			},
+			iterations: 3,
+			tasks:      1,
+			failed:     true,
+			output:     []string{"#1 FAIL", "panic: middleware boom", "1 tasks, 1 failed tasks, 0 failed requests", "OnFinish ok"},
+		},
+		{
+			name: "scenario finished before the iterations",
+			task: func(l *debugLine) {},
+			build: func(l *debugLine) {
+				l.SetSequential(true)
+				l.SetIterations(1)
+				l.AddTeardownFunc(func() {})
+			},
+			iterations: 5,
+			tasks:      2,
+			output:     []string{"#2 ok", "2 tasks, 0 failed tasks, 0 failed requests"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRecorder(t)
+			finished := 0
+			l := New()
+			if tt.middleware != nil {
+				l.Use(tt.middleware)
+			}
+			l.ResetLine(func() ILine {
+				line := &debugLine{Line: NewLine(), startErr: tt.startErr, task: tt.task, finished: &finished}
+				if tt.task != nil {
+					line.AddWeightFunc(line.Order, 1)
+				}
+				if tt.build != nil {
+					tt.build(line)
+				}
+				return line
+			})
+
+			var out bytes.Buffer
+			d := &debugRunner{lead: l, out: &out, iterations: tt.iterations}
+			err := d.run()
+			if failed := errors.Is(err, ErrDebugFailed); failed != tt.failed {
+				t.Fatalf("run() = %v, want failed %v\n%s", err, tt.failed, out.String())
+			}
+			if d.tasks != tt.tasks {
+				t.Fatalf("%d tasks run, want %d", d.tasks, tt.tasks)
+			}
+			if finished != 1 {
+				t.Fatalf("OnFinish called %d times, want 1", finished)
+			}
+			for _, s := range tt.output {
+				if !strings.Contains(out.String(), s) {
+					t.Fatalf("output does not contain %q:\n%s", s, out.String())
+				}
+			}
+
+			// 结束后恢复 leadutil.RecordSuccess、RecordFailure
+			leadutil.RecordSuccess("http", "/after", 0, 0)
+			if records := r.get(); len(records) != 1 || records[0].name != "/after" {
+				t.Fatalf("records after run = %+v", records)
+			}
+		})
+	}
+}
+
+func TestDebugRunnerTestHooks(t *testing.T) {
+	var stopped interface{}
+	l := New()
+	l.ResetLine(func() ILine {
+		line := &debugLine{Line: NewLine(), task: func(l *debugLine) {}, finished: new(int)}
+		line.AddWeightFunc(line.Order, 1)
+		return line
+	})
+	l.OnTestStart(func(ctx context.Context) (interface{}, error) {
+		return "tenant", nil
+	})
+	l.OnTestStop(func(ctx context.Context, fixture interface{}) error {
+		stopped = fixture
+		return nil
+	})
+
+	var out bytes.Buffer
+	if err := (&debugRunner{lead: l, out: &out, iterations: 1}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if stopped != "tenant" {
+		t.Fatalf("OnTestStop got fixture %v", stopped)
+	}
+
+	// OnTestStart 失败时不运行虚拟用户
+	l.OnTestStart(func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("no tenant")
+	})
+	out.Reset()
+	d := &debugRunner{lead: l, out: &out, iterations: 1}
+	if err := d.run(); !errors.Is(err, ErrDebugFailed) || !strings.Contains(err.Error(), "OnTestStart") {
+		t.Fatalf("run() = %v, want OnTestStart failed", err)
+	}
+	if d.tasks != 0 {
+		t.Fatalf("%d tasks run after OnTestStart failed", d.tasks)
+	}
+}
@@ -6,6 +6,8 @@ package navigator
 
 import "github.com/Hellowlonewolf/navigator/boomer"
 
+const EventSpawn = "boomer:spawn"
+const EventSpawning = "boomer:spawning"
 const EventStop = "boomer:stop"
 const EventQuit = "boomer:quit"
 
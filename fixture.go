@@ -0,0 +1,102 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigator
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// testStopWait 执行 OnTestStop 前，在停止等待时间之外等待虚拟用户执行完 OnFinish 的时间
+const testStopWait = 5 * time.Second
+
+// TestStartFunc 测试开始时执行的函数，返回的测试数据注入每个虚拟用户，返回错误时不启动压测
+type TestStartFunc func(ctx context.Context) (fixture interface{}, err error)
+
+// TestStopFunc 测试结束时执行的函数，fixture 为 TestStartFunc 返回的测试数据
+type TestStopFunc func(ctx context.Context, fixture interface{}) error
+
+// OnTestStart 设置测试开始时执行的函数，每个 worker 在创建虚拟用户前执行一次，类似 locust 的 test_start 事件，
+// 可以用于创建租户、准备数据。返回的测试数据在虚拟用户创建后通过 SetFixture 设置，包括执行 OnStartInit 的虚拟用户。
+// 所有虚拟用户共用同一个测试数据对象，需要修改时应保证并发安全。
+//
+//	l.OnTestStart(func(ctx context.Context) (interface{}, error) {
+//		return createTenant(ctx)
+//	})
+//	l.OnTestStop(func(ctx context.Context, fixture interface{}) error {
+//		return deleteTenant(ctx, fixture.(*Tenant))
+//	})
+func (l *Lead) OnTestStart(fn TestStartFunc) {
+	l.testStart = fn
+}
+
+// OnTestStop 设置测试结束时执行的函数，在所有虚拟用户执行完 OnFinish 后执行一次，类似 locust 的 test_stop 事件，
+// 可以用于清理 OnTestStart 创建的数据。OnTestStart 返回错误时不执行。
+func (l *Lead) OnTestStop(fn TestStopFunc) {
+	l.testStop = fn
+}
+
+// Fixture OnTestStart 返回的测试数据，未设置或测试未开始时返回 nil
+func (l *Lead) Fixture() interface{} {
+	return l.fixture
+}
+
+// FixtureOf 获取虚拟用户的测试数据，line 未实现 Fixture() 方法（*Line 已实现）或测试数据不是 T 类型时返回 false
+//
+//	func (t *MyTask) OnStart() error {
+//		tenant, _ := navigator.FixtureOf[*Tenant](t)
+//		return t.Login(tenant.ID)
+//	}
+func FixtureOf[T any](line ILine) (T, bool) {
+	var zero T
+	getter, ok := line.(interface{ Fixture() interface{} })
+	if !ok {
+		return zero, false
+	}
+	fixture, ok := getter.Fixture().(T)
+	if !ok {
+		return zero, false
+	}
+	return fixture, true
+}
+
+// startTest 执行 OnTestStart 并保存测试数据
+func (l *Lead) startTest(ctx context.Context) error {
+	l.fixture = nil
+	if l.testStart == nil {
+		return nil
+	}
+	fixture, err := l.testStart(ctx)
+	if err != nil {
+		return err
+	}
+	l.fixture = fixture
+	return nil
+}
+
+// stopTest 等待所有虚拟用户执行完 OnFinish，最多等待停止等待时间加 testStopWait，然后执行 OnTestStop。
+// 缩容移除的虚拟用户不在 boomer 的等待范围内，未设置 OnTestStop 时同样等待，保证 Wait 返回时虚拟用户都已退出
+func (l *Lead) stopTest(ctx context.Context) {
+	timer := time.NewTimer(l.option.stopTimeout + testStopWait)
+	defer timer.Stop()
+wait:
+	for atomic.LoadInt64(&l.activeUsers) > 0 {
+		select {
+		case <-l.usersDone:
+		case <-timer.C:
+			log.Printf("%d users are still running after stopping\n", atomic.LoadInt64(&l.activeUsers))
+			break wait
+		}
+	}
+
+	if l.testStop == nil {
+		return
+	}
+	if err := l.testStop(ctx, l.fixture); err != nil {
+		log.Printf("OnTestStop: %v\n", err)
+	}
+}
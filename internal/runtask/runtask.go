@@ -0,0 +1,11 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package runtask
+
+import "context"
+
+// RunTask 执行虚拟用户的一个任务，依次经过 Lead 与虚拟用户的中间件，返回任务执行结果，供 navigatortest 使用，不属于公开 API。
+// lead、line、task 分别为 *navigator.Lead、navigator.ILine、*navigator.Task，由 navigator 包初始化时设置
+var RunTask func(ctx context.Context, lead, line, task interface{}) error
@@ -5,6 +5,7 @@
 package navigator
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -13,8 +14,10 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,13 +33,42 @@ func init() {
 // Lead 实现重新处理 boomer 任务逻辑，在boomer的基础上实现
 // 按对象及函数权重执行任务。
 type Lead struct {
-	lines  []func() ILine
+	lines  []*lineClass
 	option *option
+	// tagFilter 按标签筛选虚拟用户的任务，在创建虚拟用户任务时生成
+	tagFilter *tagFilter
+	// middlewares 所有虚拟用户的任务中间件
+	middlewares []Middleware
+	// store 所有虚拟用户共享的数据
+	store *leadutil.Store
+	// limit 压测的结束条件，在启动压测时生成
+	limit *runLimit
+	// activeUsers 已创建、尚未执行完 OnFinish 的虚拟用户数，通过 addUser、doneUser 修改
+	activeUsers int64
+	// usersDone activeUsers 降为0时发送通知，stopTest 等待虚拟用户退出
+	usersDone chan struct{}
+	// thresholds 阈值检查，在启动压测时生成
+	thresholds *thresholdWatcher
+	// testStart、testStop 测试开始与结束时执行的函数，fixture 为 testStart 返回的测试数据
+	testStart TestStartFunc
+	testStop  TestStopFunc
+	fixture   interface{}
+
+	// Start 启动的压测，用于 Scale、Stop、Wait、Stats 控制
+	mutex   sync.Mutex
+	current *leadRun
+}
+
+// lineClass 一类虚拟用户，对应 locust 中的一个 User 类
+type lineClass struct {
+	// name 虚拟用户类名，为空时使用虚拟用户类型名
+	name    string
+	newLine func() ILine
 }
 
 // New 创建 Lead 压测任务对象
 func New(opts ...Option) *Lead {
-	l := &Lead{}
+	l := &Lead{store: leadutil.NewStore(), usersDone: make(chan struct{}, 1)}
 	l.option = defaultOpt()
 	l.SetInterval(*IntervalFlag)
 	for _, opt := range opts {
@@ -60,118 +92,347 @@ func (l *Lead) SetInterval(interval string) {
 }
 
 // Run 运行测试任务
+// 支持传入多个虚拟用户构造方法，每个构造方法对应一类虚拟用户，
+// 生成的虚拟用户按各类用户的 Weight() 比例分配，扩缩容时保持比例不变。
+// 也可以先通过 Register 注册具名的虚拟用户构造方法，再调用 Run。
+// 使用 --debug 运行时，不连接 master，调用 Debug 调试运行。
 func (l *Lead) Run(ls ...func() ILine) {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	if debugMode() {
+		// 调试模式不连接 master，失败时以状态码1退出
+		if err := l.Debug(ls...); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	for _, fn := range ls {
+		l.lines = append(l.lines, &lineClass{newLine: fn})
+	}
+	// 压测结束后输出阈值检查结果，在 OnTestStop 之后执行
+	defer l.exitOnThresholds()
+	if l.option.arrivalRate != nil {
+		l.runArrivalRate()
+		return
+	}
 
-	l.lines = ls
-	newUser := l.lines[0]()
-	err := newUser.OnStartInit()
+	if l.option.loadShape != nil && l.option.boomerClient == nil {
+		// 负载曲线以单机模式运行，无需 master
+		l.option.boomerClient = standaloneBoomer()
+	}
+	thresholds, err := newThresholdWatcher(l.option.thresholds, l.runStats, l.quit)
 	if err != nil {
-		newUser.OnError("OnStartActivity", err)
+		log.Fatalln(err)
 	}
-	// 检查错误
-	t := &boomer.Task{
-		Weight: 100,
-		Fn:     l.forFn,
-		Name:   "lead",
+	l.thresholds = thresholds
+	l.limit, err = newRunLimit(l.option, l.quit)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := l.startTest(context.Background()); err != nil {
+		log.Fatalln("OnTestStart:", err)
+	}
+	defer l.stopTest(context.Background())
+	l.thresholds.start()
+	tasks := l.userClassTasks()
+
+	if err := l.limit.start(); err != nil {
+		log.Println(err)
 	}
 
 	if l.option.boomerClient != nil {
 		leadutil.RecordFailure = l.option.boomerClient.RecordFailure
 		leadutil.RecordSuccess = l.option.boomerClient.RecordSuccess
-		l.option.boomerClient.Run(t)
+		l.option.boomerClient.EnableUserClassMode()
+		if l.option.stopTimeout > 0 {
+			l.option.boomerClient.SetStopTimeout(l.option.stopTimeout)
+		}
+		if l.option.loadShape != nil {
+			l.option.boomerClient.SetLoadShape(l.option.loadShape)
+		}
+		l.option.boomerClient.Run(tasks...)
+		// 单机模式的 Run 在压测结束后返回
+		if l.option.boomerClient.Mode() == boomer.StandaloneMode {
+			return
+		}
+	}
+
+	boomer.EnableUserClassMode()
+	if l.option.stopTimeout > 0 {
+		boomer.SetStopTimeout(l.option.stopTimeout)
+	}
+	boomer.Run(tasks...)
+}
+
+// standaloneBoomer 创建输出到控制台的单机模式 boomer，用户数由负载曲线或开放模型控制
+func standaloneBoomer() *boomer.Boomer {
+	b := boomer.NewStandaloneBoomer(0, 0)
+	b.AddOutput(boomer.NewConsoleOutput())
+	return b
+}
+
+// runStats 获取 Run 启动的压测的统计数据，优先使用 BoomerClient 设置的 boomer
+func (l *Lead) runStats() *boomer.StatsSnapshot {
+	if l.option.boomerClient != nil {
+		return l.option.boomerClient.Stats()
+	}
+	return boomer.Stats()
+}
+
+// quit 结束 Run 启动的压测，分布式模式下向 master 发送 quit
+func (l *Lead) quit() {
+	if l.option.boomerClient != nil {
+		l.option.boomerClient.Quit()
+	}
+	boomer.Quit()
+}
+
+// Register 注册具名的虚拟用户构造方法，name 对应 locustfile 中的 User 类名。
+// 分布式模式下，master 下发的各 User 类用户数量（user_classes_count）将按名称分配给对应的虚拟用户，
+// 例如 locustfile 中 BuyerUser: 30, SellerUser: 10，则创建 30 个 "BuyerUser" 虚拟用户和 10 个 "SellerUser" 虚拟用户。
+// 重复注册同名虚拟用户时，后注册的覆盖先注册的。name 不能为空，为空时 panic。
+func (l *Lead) Register(name string, fn func() ILine) {
+	if name == "" {
+		panic(errors.New("register line without name"))
+	}
+	for _, class := range l.lines {
+		if class.name == name {
+			class.newLine = fn
+			return
+		}
+	}
+	l.lines = append(l.lines, &lineClass{name: name, newLine: fn})
+}
+
+// userClass 筛选后的一类虚拟用户
+type userClass struct {
+	name    string
+	weight  int
+	newLine func() ILine
+}
+
+// userClasses 生成标签筛选后的各类虚拟用户，执行各类虚拟用户的 OnStartInit，
+// 未命名的虚拟用户使用类型名，任务都被标签筛除的虚拟用户类不再创建。
+func (l *Lead) userClasses() []*userClass {
+	l.tagFilter = newTagFilter(l.option)
+	classes := make([]*userClass, 0, len(l.lines))
+	names := map[string]int{}
+	for _, class := range l.lines {
+		names[class.name]++
+	}
+	for _, class := range l.lines {
+		newUser := class.newLine()
+		l.inject(newUser)
+		err := newUser.OnStartInit()
+		if err != nil {
+			newUser.OnError("OnStartActivity", err)
+		}
+
+		// 未命名的虚拟用户使用类型名，同名时追加序号区分
+		name := class.name
+		if name == "" {
+			name = lineName(newUser)
+			names[name]++
+			if names[name] > 1 {
+				name = fmt.Sprintf("%s%d", name, names[name])
+			}
+		}
+
+		// 任务都被标签筛除的虚拟用户不再创建，同 locust
+		if n := len(newUser.GetTask()); !l.tagFilter.apply(newUser) && n > 0 {
+			log.Printf("all tasks of %s are filtered out by tags %v and exclude tags %v\n", name, l.tagFilter.tags, l.tagFilter.excludeTags)
+			continue
+		}
+
+		weight := newUser.Weight()
+		if weight <= 0 {
+			weight = 1
+		}
+		classes = append(classes, &userClass{name: name, weight: weight, newLine: class.newLine})
+	}
+
+	return classes
+}
+
+// userClassTasks 为每类虚拟用户创建一个 boomer 任务，
+// 任务名为虚拟用户类名，任务权重为虚拟用户权重。
+func (l *Lead) userClassTasks() []*boomer.Task {
+	classes := l.userClasses()
+	tasks := make([]*boomer.Task, 0, len(classes))
+	for _, class := range classes {
+		class := class
+		tasks = append(tasks, &boomer.Task{
+			Weight: class.weight,
+			FnCtx: func(ctx context.Context) {
+				l.forFn(ctx, class)
+			},
+			Name: class.name,
+		})
 	}
 
-	boomer.Run(t)
+	return tasks
 }
 
-// ResetLine 设置压测任务虚拟用户创建函数。
-// 注意，不要在压测进行时调用，避免出现异常。
+// Store 所有虚拟用户共享的并发安全数据，
+// 虚拟用户实现 StoreSetter 接口（*Line 已实现）时，创建后通过 SetStore 设置。
+func (l *Lead) Store() *leadutil.Store {
+	return l.store
+}
+
+// inject 为虚拟用户设置共享数据与测试数据
+func (l *Lead) inject(line ILine) {
+	if setter, ok := line.(StoreSetter); ok {
+		setter.SetStore(l.store)
+	}
+	if setter, ok := line.(FixtureSetter); ok && l.fixture != nil {
+		setter.SetFixture(l.fixture)
+	}
+}
+
+// lineName 获取虚拟用户类型名
+func lineName(line ILine) string {
+	t := reflect.TypeOf(line)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "lead"
+	}
+	return t.Name()
+}
+
+// ResetLine 设置压测任务虚拟用户创建函数，已注册的虚拟用户构造方法会被清除。
+// 注意，需在 Run 之前调用，避免出现异常。
 func (l *Lead) ResetLine(ls ...func() ILine) {
-	l.lines = ls
+	l.lines = nil
+	for _, fn := range ls {
+		l.lines = append(l.lines, &lineClass{newLine: fn})
+	}
+}
+
+// runPanic 输出虚拟用户运行中的 panic 与调用栈，并调用虚拟用户的 OnError，需在 recover 的 defer 中调用
+func runPanic(user Liner, err interface{}) {
+	stackTrace := debug.Stack()
+	errMsg := fmt.Sprintf("%v", err)
+	os.Stderr.Write([]byte(errMsg))
+	os.Stderr.Write([]byte("\n"))
+	os.Stderr.Write(stackTrace)
+	if user != nil {
+		user.OnError("Run Panic", errors.New(errMsg+"\n"+string(stackTrace)))
+	}
 }
 
-func (l *Lead) forFn() {
+// addUser 创建虚拟用户时计数
+func (l *Lead) addUser() {
+	atomic.AddInt64(&l.activeUsers, 1)
+}
+
+// doneUser 虚拟用户执行完 OnFinish 后计数，所有虚拟用户都退出时通知 stopTest
+func (l *Lead) doneUser() {
+	if atomic.AddInt64(&l.activeUsers, -1) == 0 {
+		select {
+		case l.usersDone <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forFn 运行一个虚拟用户，ctx 在该虚拟用户被停止或缩容时取消
+func (l *Lead) forFn(ctx context.Context, class *userClass) {
 	var user Liner
 	var status int
-	quitChan := make(chan bool)
+	// stopping 在该虚拟用户被停止或缩容时关闭，此时执行完当前任务后退出，
+	// ctx 在超过停止等待时间（StopTimeout）后取消
+	stopping := boomer.Stopping(ctx)
+	select {
+	case <-stopping:
+		return
+	default:
+	}
 
 	defer l.reset()
 	defer func() {
 		// don't panic
-		err := recover()
-		if err != nil {
-			stackTrace := debug.Stack()
-			errMsg := fmt.Sprintf("%v", err)
-			os.Stderr.Write([]byte(errMsg))
-			os.Stderr.Write([]byte("\n"))
-			os.Stderr.Write(stackTrace)
-			if user != nil {
-				user.OnError("Run Panic", errors.New(errMsg+"\n"+string(stackTrace)))
-			}
+		if err := recover(); err != nil {
+			runPanic(user, err)
 		}
-		// TODO: 优化流程
 		if user != nil {
-			user.OnFinish()
+			func() {
+				// OnFinish 执行后归还虚拟用户持有的资源，OnFinish panic 时也会归还
+				defer l.doneUser()
+				defer ReleaseHeld(user)
+				user.OnFinish()
+			}()
 		}
 
+		// 已中断的虚拟用户等待停止，避免 boomer 立即重新创建虚拟用户
 		if status == StatusInterrupt {
-			<-quitChan
+			<-stopping
+			return
 		}
 
-		time.Sleep(l.option.retryInCriticalInterval)
-
+		// 停止中的虚拟用户不再等待重试
+		timer := leadutil.GetTimer(l.option.retryInCriticalInterval)
+		select {
+		case <-timer.C:
+		case <-stopping:
+		}
+		leadutil.PutTimer(timer)
 	}()
 
-	// 收到locust 的停止指令后，停止任务
-	closeChan := &sync.Once{}
-
-	err := Events.SubscribeOnce(EventStop, func() {
-		closeChan.Do(func() {
-			close(quitChan)
-		})
-	})
-	if err != nil {
-		user.OnError("SubscribeOnce EventStop", err)
-	}
-
-	// 检查程序退出
-	// 启动循环，根据权重创建虚拟用户以及执行初始化操作
-	newUser := l.lines[0]()
+	// 启动循环，创建虚拟用户以及执行初始化操作
+	newUser := class.newLine()
 	var ok bool
 	if user, ok = newUser.(Liner); !ok {
 		user = &wrapLine{newUser}
 	}
+	l.addUser()
 
+	l.inject(newUser)
+	l.tagFilter.apply(user)
 	user.Init()
-	err = user.OnStart()
+	err := l.startUser(stopping, class.name, user)
+	if errors.Is(err, leadutil.ErrFeederStop) {
+		// 数据源的数据已取完，停止该虚拟用户
+		log.Printf("task interrupt:%v\n", err)
+		status = StatusInterrupt
+		return
+	}
 	if err != nil {
-		user.OnError("OnStartError", err)
-		go func() {
-			boomer.WorkerClose <- 1
-		}()
+		// 按 OnStartPolicy 重试后仍失败，等待后由 boomer 创建新的虚拟用户代替
+		l.limit.startFailed()
 		return
-
 	}
 
 	var interval time.Duration
-	var nextTime time.Time
 	var taskCycle int64
 
+	waitTime := l.waitTime(newUser)
+	handler := l.taskHandler(newUser, l.option.taskTimeout)
 	startTime := time.Now()
 
 	for {
-		interval = l.option.interval
 		startTime = time.Now()
-		if l.option.enableDynamicInterval {
-			nextTime = startTime.Add(interval)
-		}
 
 		select {
-		case <-quitChan:
+		case <-stopping:
+			return
+		case <-ctx.Done():
 			return
 		default:
 			if nextTask := user.Next(); nextTask != nil {
-				nextTask.Fn()
+				if !l.limit.take() {
+					// 共享任务次数已用完
+					status = StatusInterrupt
+					return
+				}
+				handler(&TaskContext{
+					Ctx:  ctx,
+					Task: nextTask,
+					Line: newUser,
+				})
 				taskCycle++
 
 				if l.option.taskCycle > 0 {
@@ -196,17 +457,44 @@ func (l *Lead) forFn() {
 					continue
 				}
 
+			} else if user.Status() == StatusInterrupt {
+				// 虚拟用户所有阶段执行完成
+				log.Printf("task interrupt:taskCycle:%d,status:%d\n", taskCycle, user.Status())
+				status = StatusInterrupt
+				return
 			} else {
 				user.OnError("NextTask", errors.New("next task not found"))
 			}
 		}
 
-		if l.option.enableDynamicInterval {
-			interval = nextTime.Sub(time.Now())
+		interval = waitTime(time.Since(startTime))
+		if interval > 0 {
+			timer := leadutil.GetTimer(interval)
+			select {
+			case <-timer.C:
+			case <-stopping:
+			}
+			leadutil.PutTimer(timer)
 		}
+	}
+}
 
-		if interval > 0 {
-			time.Sleep(interval)
+// waitTime 获取虚拟用户的等待时间策略，优先使用虚拟用户自己的等待时间策略，
+// 其次为 WaitTime 设置的等待时间策略，都未设置时使用 interval 与 enableDynamicInterval 设置。
+func (l *Lead) waitTime(line ILine) WaitTimeFunc {
+	if waitTimer, ok := line.(WaitTimer); ok {
+		if waitTime := waitTimer.WaitTime(); waitTime != nil {
+			return waitTime
+		}
+	}
+	if l.option.waitTime != nil {
+		return l.option.waitTime
+	}
+
+	return func(elapsed time.Duration) time.Duration {
+		if l.option.enableDynamicInterval {
+			return l.option.interval - elapsed
 		}
+		return l.option.interval
 	}
 }
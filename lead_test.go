@@ -0,0 +1,240 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:04
+ */
+package navigator
+
+import (
+	"context"
+	"github.com/Hellowlonewolf/navigator/boomer"
+	"github.com/myzhan/gomq/zmtp"
+	"github.com/ugorji/go/codec"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countReleaser 统计归还次数的资源
+type countReleaser struct {
+	released *int64
+}
+
+func (r countReleaser) Release() {
+	atomic.AddInt64(r.released, 1)
+}
+
+// scaleLine 测试缩容的虚拟用户，任务不响应 ctx，只能在任务之间通过停止信号退出
+type scaleLine struct {
+	*Line
+	finished *int64
+	released *int64
+	canceled *int64
+}
+
+func (l *scaleLine) OnStart() error {
+	l.Hold(countReleaser{released: l.released})
+	return nil
+}
+
+func (l *scaleLine) OnFinish() {
+	atomic.AddInt64(l.finished, 1)
+}
+
+func (l *scaleLine) Work(ctx context.Context) {
+	time.Sleep(20 * time.Millisecond)
+	if ctx.Err() != nil {
+		atomic.AddInt64(l.canceled, 1)
+	}
+}
+
+func TestLeadScaleDownStopsUsers(t *testing.T) {
+	var finished, released, canceled int64
+	l := New(Interval("0s"), StopTimeout("10s"))
+	l.ResetLine(func() ILine {
+		line := &scaleLine{Line: NewLine(), finished: &finished, released: &released, canceled: &canceled}
+		line.AddWeightFuncCtx(line.Work, 1)
+		return line
+	})
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		l.Stop()
+		l.Wait()
+	}()
+
+	if err := l.Scale(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "3 active users", func() bool { return l.ActiveUsers() == 3 })
+
+	// 缩容的虚拟用户执行完当前任务后通过自己的停止信号退出，远早于停止等待时间
+	start := time.Now()
+	if err := l.Scale(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "1 active user", func() bool { return l.ActiveUsers() == 1 })
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("scaled-down users stop after %v", elapsed)
+	}
+	if n := atomic.LoadInt64(&finished); n != 2 {
+		t.Fatalf("OnFinish called %d times, want 2", n)
+	}
+	if n := atomic.LoadInt64(&released); n != 2 {
+		t.Fatalf("held resources released %d times, want 2", n)
+	}
+	if n := atomic.LoadInt64(&canceled); n != 0 {
+		t.Fatalf("ctx of %d tasks is canceled", n)
+	}
+	if stats := l.Stats(); stats == nil || stats.UserCount != 1 || stats.ForceStoppedCount != 0 {
+		t.Fatalf("unexpected stats after scaling down: %+v", stats)
+	}
+
+	// 剩余的虚拟用户继续执行
+	time.Sleep(50 * time.Millisecond)
+	if l.ActiveUsers() != 1 || atomic.LoadInt64(&finished) != 2 {
+		t.Fatal("the remaining user is stopped")
+	}
+}
+
+// weightLine 测试虚拟用户类分配的虚拟用户
+type weightLine struct {
+	*Line
+}
+
+func newWeightLine(weight int) func() ILine {
+	return func() ILine {
+		l := &weightLine{Line: NewLine()}
+		l.SetWeight(weight)
+		l.AddWeightFunc(func() {}, 1)
+		return l
+	}
+}
+
+func TestLeadUserClassTasks(t *testing.T) {
+	tests := []struct {
+		name        string
+		weights     []int
+		wantNames   []string
+		wantWeights []int
+	}{
+		{name: "weighted", weights: []int{3, 1}, wantNames: []string{"weightLine", "weightLine2"}, wantWeights: []int{3, 1}},
+		{name: "single class with weight 0", weights: []int{0}, wantNames: []string{"weightLine"}, wantWeights: []int{1}},
+		{name: "weight 0 counts as 1", weights: []int{0, 1}, wantNames: []string{"weightLine", "weightLine2"}, wantWeights: []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []func() ILine
+			for _, weight := range tt.weights {
+				lines = append(lines, newWeightLine(weight))
+			}
+			l := New()
+			l.ResetLine(lines...)
+			var names []string
+			var weights []int
+			for _, task := range l.userClassTasks() {
+				names = append(names, task.Name)
+				weights = append(weights, task.Weight)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) || !reflect.DeepEqual(weights, tt.wantWeights) {
+				t.Fatalf("tasks %q with weights %v, want %q with %v", names, weights, tt.wantNames, tt.wantWeights)
+			}
+		})
+	}
+}
+
+func TestLeadRegisterEmptyName(t *testing.T) {
+	l := New()
+	l.ResetLine(newWeightLine(1))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register() with an empty name doesn't panic")
+		}
+		if len(l.lines) != 1 {
+			t.Fatalf("%d lines registered, want the unnamed line only", len(l.lines))
+		}
+	}()
+	l.Register("", newWeightLine(2))
+}
+
+// classLine 测试按 User 类名创建的虚拟用户，started 统计启动的虚拟用户数
+type classLine struct {
+	*Line
+	started *int64
+}
+
+func newClassLine(started *int64) func() ILine {
+	return func() ILine {
+		l := &classLine{Line: NewLine(), started: started}
+		// 任务一直阻塞，每个 worker 只创建一个虚拟用户
+		l.AddWeightFunc(func() { select {} }, 1)
+		return l
+	}
+}
+
+func (l *classLine) OnStart() error {
+	atomic.AddInt64(l.started, 1)
+	return nil
+}
+
+// masterMessage 编码 master 发送的消息，格式同 locust：[type, data, node_id]
+func masterMessage(t *testing.T, msgType string, data map[string]interface{}, nodeID string) *zmtp.Message {
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, &codec.MsgpackHandle{}).Encode([]interface{}{msgType, data, nodeID}); err != nil {
+		t.Fatal(err)
+	}
+	return &zmtp.Message{MessageType: zmtp.UserMessage, Body: [][]byte{out}}
+}
+
+func TestLeadRegisterUserClassesFromMaster(t *testing.T) {
+	dealer := boomer.MockGomqDealerInstance
+	// 读取 worker 发送给 master 的消息，获取 client_ready 中的 node_id
+	nodeID := make(chan string, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		h := &codec.MsgpackHandle{}
+		h.RawToString = true
+		for {
+			select {
+			case raw := <-dealer.SendChannel():
+				var msg []interface{}
+				if err := codec.NewDecoderBytes(raw, h).Decode(&msg); err == nil && len(msg) == 3 && msg[0] == "client_ready" {
+					nodeID <- msg[2].(string)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var buyers, sellers int64
+	l := New()
+	l.Register("BuyerUser", newClassLine(&buyers))
+	l.Register("SellerUser", newClassLine(&sellers))
+	b := boomer.NewBoomer("mock:0.0.0.0", 5557)
+	b.EnableUserClassMode()
+	b.Run(l.userClassTasks()...)
+	defer b.Quit()
+
+	var id string
+	select {
+	case id = <-nodeID:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for client_ready")
+	}
+	// 与虚拟用户同名的 User 类按数量创建，没有同名虚拟用户的 User 类被忽略
+	dealer.RecvChannel() <- masterMessage(t, "spawn", map[string]interface{}{
+		"timestamp":          int64(1),
+		"user_classes_count": map[string]interface{}{"BuyerUser": int64(3), "SellerUser": int64(1), "AdminUser": int64(2)},
+	}, id)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&buyers) != 3 || atomic.LoadInt64(&sellers) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d BuyerUser and %d SellerUser users started, want 3 and 1", atomic.LoadInt64(&buyers), atomic.LoadInt64(&sellers))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
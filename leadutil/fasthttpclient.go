@@ -5,6 +5,7 @@
 package leadutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/valyala/fasthttp"
@@ -75,12 +76,13 @@ func (client *FastHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response,
 	}
 
 	now := time.Now()
-	err := client.client.Do(req, resp)
+	err := client.do(opt.ctx, req, resp)
 	elapsed := GetElapsedMS(now)
 
 	resp.Header.Set("elapsed", strconv.Itoa(int(elapsed)))
 
-	if err != nil {
+	// 虚拟用户停止时 ctx 被取消，未完成的请求不记录为失败，ctx 超时仍记录为失败
+	if err != nil && !canceled(opt.ctx, err) {
 		RecordFailure("http", opt.actionName, elapsed, fmt.Sprint(err))
 	}
 
@@ -90,7 +92,8 @@ func (client *FastHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response,
 		opt.statusCodeHandler(statusCode, req, resp)
 	}
 
-	if opt.autoRecordLocustMsg {
+	// 请求出错时已记录失败
+	if opt.autoRecordLocustMsg && err == nil {
 		if statusCode >= 400 {
 			err = errors.New(fmt.Sprintf("status code:%d,body:%s", statusCode, resp.Body()))
 			RecordFailure("http", opt.actionName, elapsed, err.Error())
@@ -102,6 +105,50 @@ func (client *FastHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response,
 	return err
 }
 
+// do 执行请求，ctx 有截止时间时按截止时间超时，ctx 被取消时立即返回 ctx.Err()，
+// 已发出的请求在后台完成后回收。
+func (client *FastHTTPClient) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if ctx == nil || ctx.Done() == nil {
+		return client.client.Do(req, resp)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 请求在后台执行，ctx 取消后 req、resp 可能已被调用方回收，因此使用副本
+	reqCopy := fasthttp.AcquireRequest()
+	respCopy := fasthttp.AcquireResponse()
+	req.CopyTo(reqCopy)
+	errChan := make(chan error, 1)
+	go func() {
+		if deadline, ok := ctx.Deadline(); ok {
+			errChan <- client.client.DoDeadline(reqCopy, respCopy, deadline)
+		} else {
+			errChan <- client.client.Do(reqCopy, respCopy)
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		respCopy.CopyTo(resp)
+		fasthttp.ReleaseRequest(reqCopy)
+		fasthttp.ReleaseResponse(respCopy)
+		return err
+	case <-ctx.Done():
+		go func() {
+			<-errChan
+			fasthttp.ReleaseRequest(reqCopy)
+			fasthttp.ReleaseResponse(respCopy)
+		}()
+		return ctx.Err()
+	}
+}
+
+// canceled 请求是否因 ctx 被取消而返回
+func canceled(ctx context.Context, err error) bool {
+	return ctx != nil && errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled)
+}
+
 func (client *FastHTTPClient) Post(url string, data []byte, opts ...Option) (*fasthttp.Response, error) {
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
@@ -114,12 +161,13 @@ func (client *FastHTTPClient) Post(url string, data []byte, opts ...Option) (*fa
 
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.SetBody(data)
-	err := client.Do(req, resp)
+	err := client.Do(req, resp, opts...)
 
 	return resp, err
 }
 
 type option struct {
+	ctx                 context.Context
 	header              map[string]string
 	actionName          string
 	autoRecordLocustMsg bool
@@ -127,6 +175,10 @@ type option struct {
 }
 
 func (opt *option) Reset() {
+	opt.ctx = nil
+	opt.actionName = ""
+	opt.autoRecordLocustMsg = true
+	opt.statusCodeHandler = nil
 	for k := range opt.header {
 		delete(opt.header, k)
 	}
@@ -185,6 +237,15 @@ func StatusCodeHandler(fn func(code int, req *fasthttp.Request, resp *fasthttp.R
 	}
 }
 
+// Context 设置请求的 context，ctx 被取消或超时后请求立即返回错误，
+// 一般传入 AddWeightFuncCtx 任务函数的 ctx，使虚拟用户停止时不必等待请求完成。
+// ctx 被取消时请求不记录为失败，ctx 超时时记录为失败。
+func Context(ctx context.Context) Option {
+	return func(o *option) {
+		o.ctx = ctx
+	}
+}
+
 // DisableRecordLocustMsg 关闭自动记录locust信息
 func DisableRecordLocustMsg() Option {
 	return func(o *option) {
@@ -0,0 +1,173 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 11:57
+ */
+package leadutil
+
+import (
+	"context"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFastHTTPClientContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tests := []struct {
+		name     string
+		path     string
+		ctx      func() (context.Context, context.CancelFunc)
+		wantErr  bool
+		failures int
+		success  int
+	}{
+		{
+			name:    "success",
+			path:    "/fast",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			success: 1,
+		},
+		{
+			name: "canceled when stopping",
+			path: "/slow",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: true,
+		},
+		{
+			name: "canceled before the request",
+			path: "/fast",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantErr: true,
+		},
+		{
+			name: "timeout",
+			path: "/slow",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			wantErr:  true,
+			failures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var failures, success int
+			oldSuccess, oldFailure := RecordSuccess, RecordFailure
+			defer func() {
+				RecordSuccess, RecordFailure = oldSuccess, oldFailure
+			}()
+			RecordSuccess = func(requestType, name string, responseTime int64, responseLength int64) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				success++
+			}
+			RecordFailure = func(requestType, name string, responseTime int64, exception string) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				failures++
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			resp, err := NewFastHTTPClient().Get(server.URL+tt.path, Context(ctx))
+			ReleaseResponse(resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() = %v, want error %v", err, tt.wantErr)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if failures != tt.failures || success != tt.success {
+				t.Fatalf("%d failures and %d successes recorded, want %d and %d", failures, success, tt.failures, tt.success)
+			}
+		})
+	}
+}
+
+func TestFastHTTPClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		do       func(client *FastHTTPClient)
+		success  []string
+		failures []string
+	}{
+		{
+			name: "post with options",
+			do: func(client *FastHTTPClient) {
+				resp, _ := client.Post(server.URL+"/order", nil, ActionName("order"))
+				ReleaseResponse(resp)
+			},
+			success: []string{"order"},
+		},
+		{
+			name: "failed request is recorded once",
+			do: func(client *FastHTTPClient) {
+				resp, _ := client.Get(closed.URL + "/order")
+				ReleaseResponse(resp)
+			},
+			failures: []string{"/order"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var success, failures []string
+			oldSuccess, oldFailure := RecordSuccess, RecordFailure
+			defer func() {
+				RecordSuccess, RecordFailure = oldSuccess, oldFailure
+			}()
+			RecordSuccess = func(requestType, name string, responseTime int64, responseLength int64) {
+				success = append(success, name)
+			}
+			RecordFailure = func(requestType, name string, responseTime int64, exception string) {
+				failures = append(failures, name)
+			}
+
+			tt.do(NewFastHTTPClient())
+			if !reflect.DeepEqual(success, tt.success) || !reflect.DeepEqual(failures, tt.failures) {
+				t.Fatalf("recorded successes %q and failures %q, want %q and %q", success, failures, tt.success, tt.failures)
+			}
+		})
+	}
+}
+
+func TestOptionReset(t *testing.T) {
+	opt := defaultOption()
+	for _, o := range []Option{
+		Header("token", "abc"),
+		ActionName("order"),
+		DisableRecordLocustMsg(),
+		StatusCodeHandler(func(code int, req *fasthttp.Request, resp *fasthttp.Response) {}),
+		Context(context.Background()),
+	} {
+		o(opt)
+	}
+	opt.Reset()
+	if want := defaultOption(); !reflect.DeepEqual(opt, want) {
+		t.Fatalf("option after Reset() = %+v, want %+v", opt, want)
+	}
+}
@@ -0,0 +1,255 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:01
+ */
+package leadutil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFeederStop 数据已取完，且结束策略为 FeedEndStop，
+	// 在 OnStart 中返回该错误时，navigator 停止该虚拟用户
+	ErrFeederStop = errors.New("feeder: no more data, stop the user")
+	// ErrFeederExhausted 数据已取完，且结束策略为 FeedEndFail
+	ErrFeederExhausted = errors.New("feeder: no more data")
+)
+
+// FeederStrategy 取数策略
+type FeederStrategy int
+
+const (
+	// FeedSequential 按数据顺序取数，每行数据仅被取一次，取完后按结束策略处理
+	FeedSequential FeederStrategy = iota
+	// FeedRandom 随机取数，数据可能被重复取到，不会取完
+	FeedRandom
+	// FeedUnique 按随机顺序取数，每行数据仅被一个虚拟用户取到，取完后按结束策略处理
+	FeedUnique
+	// FeedCircular 按数据顺序取数，取完后从头开始，不会取完
+	FeedCircular
+)
+
+// FeederEndPolicy 数据取完后的结束策略，仅对 FeedSequential 与 FeedUnique 生效
+type FeederEndPolicy int
+
+const (
+	// FeedEndStop 返回 ErrFeederStop，停止该虚拟用户
+	FeedEndStop FeederEndPolicy = iota
+	// FeedEndRecycle 从头开始重新取数，FeedUnique 会重新打乱顺序
+	FeedEndRecycle
+	// FeedEndFail 返回 ErrFeederExhausted
+	FeedEndFail
+)
+
+// FeederOption 数据源设置
+type FeederOption func(f *Feeder)
+
+// FeedStrategy 设置取数策略，默认为 FeedSequential
+func FeedStrategy(strategy FeederStrategy) FeederOption {
+	return func(f *Feeder) {
+		f.strategy = strategy
+	}
+}
+
+// FeedEndPolicy 设置数据取完后的结束策略，默认为 FeedEndStop
+func FeedEndPolicy(endPolicy FeederEndPolicy) FeederOption {
+	return func(f *Feeder) {
+		f.endPolicy = endPolicy
+	}
+}
+
+// Feeder 虚拟用户数据源，可以被多个虚拟用户并发使用，
+// 一般在 OnStart 中通过 Feed 将一行数据写入虚拟用户的 Map。
+type Feeder struct {
+	mutex     sync.Mutex
+	rows      []map[string]interface{}
+	strategy  FeederStrategy
+	endPolicy FeederEndPolicy
+	// order FeedUnique 的取数顺序
+	order  []int
+	cursor int
+	rand   *rand.Rand
+}
+
+// NewFeeder 使用内存中的数据创建数据源
+func NewFeeder(rows []map[string]interface{}, opts ...FeederOption) *Feeder {
+	f := &Feeder{
+		rows: rows,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.reset()
+	return f
+}
+
+// NewCSVFeeder 读取 CSV 文件创建数据源，第一行为列名，每行数据的值为字符串
+func NewCSVFeeder(path string, opts ...FeederOption) (*Feeder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("read csv %s: %w", path, err)
+	}
+	return NewFeeder(rows, opts...), nil
+}
+
+// NewJSONLFeeder 读取 JSONL 文件创建数据源，每行为一个 JSON 对象，空行被忽略
+func NewJSONLFeeder(path string, opts ...FeederOption) (*Feeder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readJSONL(file)
+	if err != nil {
+		return nil, fmt.Errorf("read jsonl %s: %w", path, err)
+	}
+	return NewFeeder(rows, opts...), nil
+}
+
+func readCSV(r io.Reader) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, key := range header {
+			row[key] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readJSONL(r io.Reader) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// reset 从头开始取数，FeedUnique 重新打乱顺序
+func (f *Feeder) reset() {
+	f.cursor = 0
+	if f.strategy == FeedUnique {
+		f.order = f.rand.Perm(len(f.rows))
+	}
+}
+
+// Next 取一行数据，返回的数据为副本，可以修改。
+// 数据取完时，按结束策略返回 ErrFeederStop、ErrFeederExhausted 或重新取数。
+func (f *Feeder) Next() (map[string]interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n := len(f.rows)
+	if n == 0 {
+		return nil, f.endError()
+	}
+
+	var i int
+	switch f.strategy {
+	case FeedRandom:
+		i = f.rand.Intn(n)
+	case FeedCircular:
+		i = f.cursor % n
+		f.cursor = (f.cursor + 1) % n
+	default:
+		if f.cursor >= n {
+			if f.endPolicy != FeedEndRecycle {
+				return nil, f.endError()
+			}
+			f.reset()
+		}
+		i = f.cursor
+		if f.strategy == FeedUnique {
+			i = f.order[f.cursor]
+		}
+		f.cursor++
+	}
+
+	row := make(map[string]interface{}, len(f.rows[i]))
+	for k, v := range f.rows[i] {
+		row[k] = v
+	}
+	return row, nil
+}
+
+func (f *Feeder) endError() error {
+	if f.endPolicy == FeedEndFail {
+		return ErrFeederExhausted
+	}
+	return ErrFeederStop
+}
+
+// Feed 取一行数据并写入 m，一般在虚拟用户的 OnStart 中调用
+//
+//	func (m *MyTask) OnStart() error {
+//		return accounts.Feed(&m.Data)
+//	}
+func (f *Feeder) Feed(m *Map) error {
+	row, err := f.Next()
+	if err != nil {
+		return err
+	}
+	if m.data == nil {
+		m.data = map[string]interface{}{}
+	}
+	m.Update(row)
+	return nil
+}
+
+// Len 数据总行数
+func (f *Feeder) Len() int {
+	return len(f.rows)
+}
+
+// Remaining 剩余可取的行数，FeedRandom 与 FeedCircular 不会取完，返回总行数
+func (f *Feeder) Remaining() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch f.strategy {
+	case FeedRandom, FeedCircular:
+		return len(f.rows)
+	}
+	return len(f.rows) - f.cursor
+}
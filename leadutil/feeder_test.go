@@ -0,0 +1,124 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:02
+ */
+package leadutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRows(n int) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		rows = append(rows, map[string]interface{}{"id": i})
+	}
+	return rows
+}
+
+func TestFeederSequential(t *testing.T) {
+	f := NewFeeder(testRows(3))
+	for i := 0; i < 3; i++ {
+		row, err := f.Next()
+		if err != nil || row["id"] != i {
+			t.Fatalf("unexpected row: %v, err: %v", row, err)
+		}
+	}
+	if _, err := f.Next(); !errors.Is(err, ErrFeederStop) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	f = NewFeeder(testRows(3), FeedEndPolicy(FeedEndFail))
+	for i := 0; i < 3; i++ {
+		f.Next()
+	}
+	if _, err := f.Next(); !errors.Is(err, ErrFeederExhausted) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	f = NewFeeder(testRows(3), FeedEndPolicy(FeedEndRecycle))
+	for i := 0; i < 3; i++ {
+		f.Next()
+	}
+	if row, err := f.Next(); err != nil || row["id"] != 0 {
+		t.Errorf("unexpected row: %v, err: %v", row, err)
+	}
+}
+
+func TestFeederUnique(t *testing.T) {
+	f := NewFeeder(testRows(100), FeedStrategy(FeedUnique))
+	seen := map[interface{}]bool{}
+	for i := 0; i < 100; i++ {
+		row, err := f.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[row["id"]] {
+			t.Fatalf("duplicate row: %v", row)
+		}
+		seen[row["id"]] = true
+	}
+	if f.Remaining() != 0 {
+		t.Errorf("unexpected remaining: %d", f.Remaining())
+	}
+	if _, err := f.Next(); !errors.Is(err, ErrFeederStop) {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestFeederCircularAndRandom(t *testing.T) {
+	f := NewFeeder(testRows(2), FeedStrategy(FeedCircular))
+	for i := 0; i < 5; i++ {
+		row, err := f.Next()
+		if err != nil || row["id"] != i%2 {
+			t.Fatalf("unexpected row: %v, err: %v", row, err)
+		}
+	}
+
+	f = NewFeeder(testRows(2), FeedStrategy(FeedRandom))
+	for i := 0; i < 5; i++ {
+		if _, err := f.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFeederFiles(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "accounts.csv")
+	os.WriteFile(csvPath, []byte("username,password\nu1,p1\nu2,p2\n"), 0644)
+	jsonlPath := filepath.Join(dir, "accounts.jsonl")
+	os.WriteFile(jsonlPath, []byte("{\"username\":\"u1\",\"age\":18}\n\n{\"username\":\"u2\",\"age\":20}\n"), 0644)
+
+	f, err := NewCSVFeeder(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Map{}
+	if err := f.Feed(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.GetString("username") != "u1" || m.GetString("password") != "p1" {
+		t.Errorf("unexpected csv row: %v", m.data)
+	}
+
+	f, err = NewJSONLFeeder(jsonlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 2 {
+		t.Errorf("unexpected len: %d", f.Len())
+	}
+	f.Next()
+	row, _ := f.Next()
+	if row["username"] != "u2" || row["age"] != float64(20) {
+		t.Errorf("unexpected jsonl row: %v", row)
+	}
+
+	if _, err := NewJSONLFeeder(csvPath); err == nil {
+		t.Error("expected error for invalid jsonl")
+	}
+}
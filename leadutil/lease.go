@@ -0,0 +1,153 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:01
+ */
+package leadutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLeaseTimeout 在超时时间内未获取到资源
+var ErrLeaseTimeout = errors.New("lease pool: acquire timeout")
+
+// Releaser 可归还的资源，navigator 的 Line.Hold 持有的资源在虚拟用户结束时自动归还
+type Releaser interface {
+	Release()
+}
+
+// Lease 从资源池中独占获取的资源，使用完后需调用 Release 归还，重复归还无影响
+type Lease[T any] struct {
+	Value T
+	pool  *LeasePool[T]
+	once  sync.Once
+}
+
+// Release 归还资源
+func (l *Lease[T]) Release() {
+	l.once.Do(func() {
+		l.pool.release(l.Value)
+	})
+}
+
+// LeaseStats 资源池统计数据
+type LeaseStats struct {
+	// Size 资源总数
+	Size int
+	// Available 可获取的资源数
+	Available int
+	// Acquired 累计获取次数
+	Acquired int64
+	// Starved 获取时没有可用资源需要等待的次数
+	Starved int64
+	// Timeouts 等待超时或 ctx 取消的次数
+	Timeouts int64
+	// TotalWait 累计等待时间
+	TotalWait time.Duration
+	// MaxWait 最长等待时间
+	MaxWait time.Duration
+}
+
+// LeasePool 独占资源池，用于测试账号、设备ID等稀缺资源，
+// 同一资源同时只会被一个虚拟用户持有，可以被多个虚拟用户并发使用。
+type LeasePool[T any] struct {
+	available chan T
+	size      int
+
+	acquired  int64
+	starved   int64
+	timeouts  int64
+	totalWait int64
+	maxWait   int64
+}
+
+// NewLeasePool 使用 items 创建资源池
+func NewLeasePool[T any](items []T) *LeasePool[T] {
+	p := &LeasePool[T]{
+		available: make(chan T, len(items)),
+		size:      len(items),
+	}
+	for _, item := range items {
+		p.available <- item
+	}
+	return p
+}
+
+// TryAcquire 获取资源，没有可用资源时立即返回 false
+func (p *LeasePool[T]) TryAcquire() (*Lease[T], bool) {
+	select {
+	case item := <-p.available:
+		atomic.AddInt64(&p.acquired, 1)
+		return p.newLease(item), true
+	default:
+		return nil, false
+	}
+}
+
+// Acquire 获取资源，没有可用资源时阻塞等待，直到有资源归还或 ctx 取消
+func (p *LeasePool[T]) Acquire(ctx context.Context) (*Lease[T], error) {
+	if lease, ok := p.TryAcquire(); ok {
+		return lease, nil
+	}
+
+	atomic.AddInt64(&p.starved, 1)
+	start := time.Now()
+	defer p.recordWait(start)
+
+	select {
+	case item := <-p.available:
+		atomic.AddInt64(&p.acquired, 1)
+		return p.newLease(item), nil
+	case <-ctx.Done():
+		atomic.AddInt64(&p.timeouts, 1)
+		return nil, ctx.Err()
+	}
+}
+
+// AcquireTimeout 获取资源，没有可用资源时最多等待 timeout，超时返回 ErrLeaseTimeout
+func (p *LeasePool[T]) AcquireTimeout(timeout time.Duration) (*Lease[T], error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	lease, err := p.Acquire(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrLeaseTimeout
+	}
+	return lease, err
+}
+
+// Stats 获取资源池统计数据，Starved 持续增长说明资源不足
+func (p *LeasePool[T]) Stats() LeaseStats {
+	return LeaseStats{
+		Size:      p.size,
+		Available: len(p.available),
+		Acquired:  atomic.LoadInt64(&p.acquired),
+		Starved:   atomic.LoadInt64(&p.starved),
+		Timeouts:  atomic.LoadInt64(&p.timeouts),
+		TotalWait: time.Duration(atomic.LoadInt64(&p.totalWait)),
+		MaxWait:   time.Duration(atomic.LoadInt64(&p.maxWait)),
+	}
+}
+
+func (p *LeasePool[T]) newLease(item T) *Lease[T] {
+	return &Lease[T]{Value: item, pool: p}
+}
+
+func (p *LeasePool[T]) release(item T) {
+	p.available <- item
+}
+
+func (p *LeasePool[T]) recordWait(start time.Time) {
+	wait := int64(time.Since(start))
+	atomic.AddInt64(&p.totalWait, wait)
+	for {
+		maxWait := atomic.LoadInt64(&p.maxWait)
+		if wait <= maxWait || atomic.CompareAndSwapInt64(&p.maxWait, maxWait, wait) {
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:02
+ */
+package leadutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeasePoolExclusive(t *testing.T) {
+	pool := NewLeasePool([]string{"a", "b"})
+	held := map[string]bool{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := pool.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mutex.Lock()
+			if held[lease.Value] {
+				t.Errorf("%s is held concurrently", lease.Value)
+			}
+			held[lease.Value] = true
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			held[lease.Value] = false
+			mutex.Unlock()
+			lease.Release()
+			lease.Release()
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	if stats.Available != 2 || stats.Acquired != 20 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.Starved == 0 || stats.MaxWait == 0 {
+		t.Errorf("expected starvation: %+v", stats)
+	}
+}
+
+func TestLeasePoolTimeout(t *testing.T) {
+	pool := NewLeasePool([]int{1})
+	lease, ok := pool.TryAcquire()
+	if !ok || lease.Value != 1 {
+		t.Fatalf("unexpected lease: %v, %v", lease, ok)
+	}
+	if _, ok := pool.TryAcquire(); ok {
+		t.Error("expected no available lease")
+	}
+	if _, err := pool.AcquireTimeout(10 * time.Millisecond); !errors.Is(err, ErrLeaseTimeout) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if stats := pool.Stats(); stats.Timeouts != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lease.Release()
+	}()
+	if _, err := pool.AcquireTimeout(time.Second); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,200 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:01
+ */
+package leadutil
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var errStoreLoadPanic = errors.New("store: load panicked")
+
+// storeEntry 共享数据，expireAt 为零值时不过期
+type storeEntry struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+func (e *storeEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// storeCall 正在加载的数据，见 GetOrLoad
+type storeCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Store 并发安全的共享数据，由 Lead 提供给所有虚拟用户使用，
+// 支持计数器、比较并设置、过期时间与 JSON 快照。
+// 虚拟用户自己的数据请使用 Map。
+type Store struct {
+	mutex   sync.Mutex
+	data    map[string]*storeEntry
+	loading map[string]*storeCall
+}
+
+// NewStore 创建共享数据
+func NewStore() *Store {
+	return &Store{
+		data:    map[string]*storeEntry{},
+		loading: map[string]*storeCall{},
+	}
+}
+
+// get 获取未过期的数据，过期的数据被删除，需持有锁
+func (s *Store) get(key string) (*storeEntry, bool) {
+	entry, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		delete(s.data, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set 设置数据，不过期
+func (s *Store) Set(key string, value interface{}) {
+	s.SetTTL(key, value, 0)
+}
+
+// SetTTL 设置数据，ttl 后过期，ttl 为0时不过期
+func (s *Store) SetTTL(key string, value interface{}, ttl time.Duration) {
+	entry := &storeEntry{value: value}
+	if ttl > 0 {
+		entry.expireAt = time.Now().Add(ttl)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[key] = entry
+}
+
+// Get 获取数据，不存在或已过期时返回 false
+func (s *Store) Get(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Delete 删除数据
+func (s *Store) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.data, key)
+}
+
+// Incr 计数器增加 delta，返回增加后的值，数据不存在或不是 int64 时从0开始计数，过期时间不变
+func (s *Store) Incr(key string, delta int64) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		entry = &storeEntry{}
+		s.data[key] = entry
+	}
+	n, _ := entry.value.(int64)
+	n += delta
+	entry.value = n
+	return n
+}
+
+// CompareAndSet 数据等于 old 时设置为 value 并返回 true，old 为 nil 表示数据不存在，
+// 使用 reflect.DeepEqual 比较，设置后不过期
+func (s *Store) CompareAndSet(key string, old, value interface{}) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.get(key)
+	if old == nil {
+		if ok {
+			return false
+		}
+	} else if !ok || !reflect.DeepEqual(entry.value, old) {
+		return false
+	}
+	s.data[key] = &storeEntry{value: value}
+	return true
+}
+
+// GetOrLoad 获取数据，数据不存在或已过期时调用 load 加载并设置 ttl 后过期，
+// 同一时间只有一个虚拟用户执行 load，其他虚拟用户等待加载结果，加载失败时不保存。
+// 例如所有虚拟用户共用一个登录 token：
+//
+//	token, err := store.GetOrLoad("token", login, 30*time.Minute)
+func (s *Store) GetOrLoad(key string, load func() (interface{}, error), ttl time.Duration) (interface{}, error) {
+	s.mutex.Lock()
+	if entry, ok := s.get(key); ok {
+		s.mutex.Unlock()
+		return entry.value, nil
+	}
+	if call, ok := s.loading[key]; ok {
+		s.mutex.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &storeCall{done: make(chan struct{})}
+	s.loading[key] = call
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.loading, key)
+		s.mutex.Unlock()
+		close(call.done)
+	}()
+
+	// load panic 时等待的虚拟用户获取到该错误
+	call.err = errStoreLoadPanic
+	call.value, call.err = load()
+	if call.err == nil {
+		s.SetTTL(key, call.value, ttl)
+	}
+	return call.value, call.err
+}
+
+// Len 未过期的数据数量
+func (s *Store) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.purge()
+	return len(s.data)
+}
+
+// Snapshot 未过期数据的 JSON 快照，用于输出或保存压测中的共享数据
+func (s *Store) Snapshot() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.purge()
+	data := make(map[string]interface{}, len(s.data))
+	for key, entry := range s.data {
+		data[key] = entry.value
+	}
+	return json.Marshal(data)
+}
+
+// purge 删除过期数据，需持有锁
+func (s *Store) purge() {
+	now := time.Now()
+	for key, entry := range s.data {
+		if entry.expired(now) {
+			delete(s.data, key)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:02
+ */
+package leadutil
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStoreIncr(t *testing.T) {
+	store := NewStore()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Incr("orders", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := store.Incr("orders", 0); n != 5000 {
+		t.Errorf("Incr() = %d, want 5000", n)
+	}
+}
+
+func TestStoreCompareAndSet(t *testing.T) {
+	store := NewStore()
+	if !store.CompareAndSet("k", nil, "a") {
+		t.Error("CompareAndSet on absent key should succeed")
+	}
+	if store.CompareAndSet("k", nil, "b") {
+		t.Error("CompareAndSet with nil old on existing key should fail")
+	}
+	if store.CompareAndSet("k", "x", "b") {
+		t.Error("CompareAndSet with wrong old should fail")
+	}
+	if !store.CompareAndSet("k", "a", "b") {
+		t.Error("CompareAndSet with matching old should succeed")
+	}
+	if v, _ := store.Get("k"); v != "b" {
+		t.Errorf("Get() = %v, want b", v)
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	store := NewStore()
+	store.SetTTL("token", "abc", 20*time.Millisecond)
+	store.Set("forever", 1)
+
+	if v, ok := store.Get("token"); !ok || v != "abc" {
+		t.Errorf("Get() = %v, %v, want abc, true", v, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := store.Get("token"); ok {
+		t.Error("expired entry should not be returned")
+	}
+	if store.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", store.Len())
+	}
+}
+
+func TestStoreGetOrLoad(t *testing.T) {
+	store := NewStore()
+	var loads int32
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "token", nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := store.GetOrLoad("token", load, time.Minute)
+			if err != nil || v != "token" {
+				t.Errorf("GetOrLoad() = %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("load called %d times, want 1", loads)
+	}
+
+	loadErr := errors.New("login failed")
+	_, err := store.GetOrLoad("other", func() (interface{}, error) {
+		return nil, loadErr
+	}, 0)
+	if !errors.Is(err, loadErr) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, loadErr)
+	}
+	if _, ok := store.Get("other"); ok {
+		t.Error("failed load should not be stored")
+	}
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	store := NewStore()
+	store.Set("name", "navigator")
+	store.Incr("count", 2)
+
+	data, err := store.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"count":2,"name":"navigator"}` {
+		t.Errorf("Snapshot() = %s", data)
+	}
+}
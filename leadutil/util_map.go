@@ -20,6 +20,9 @@ func NewMap() *Map {
 }
 
 func (m *Map) SetValue(key string, value interface{}) {
+	if m.data == nil {
+		m.data = map[string]interface{}{}
+	}
 	m.data[key] = value
 }
 
@@ -88,105 +91,53 @@ func (m *Map) UpdateWithJsonByte(val []byte) {
 }
 
 func (m *Map) GetInt(key string, defaultVal ...int) int {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(int); ok {
-		return val
-	}
-
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetInt64(key string, defaultVal ...int64) int64 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(int64); ok {
-		return val
-	}
-
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetString(key string, defaultVal ...string) string {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(string); ok {
-		return val
-	}
-
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetFloat32(key string, defaultVal ...float32) float32 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(float32); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetFloat64(key string, defaultVal ...float64) float64 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(float64); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetByte(key string, defaultVal ...byte) byte {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.(byte); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetByteSlice(key string, defaultVal ...[]byte) []byte {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]byte); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 
 func (m *Map) GetBoolSlice(key string, defaultVal ...[]bool) []bool {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]bool); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 
 func (m *Map) GetStringSlice(key string, defaultVal ...[]string) []string {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]string); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetInt64Slice(key string, defaultVal ...[]int64) []int64 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]int64); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 
 func (m *Map) GetIntSlice(key string, defaultVal ...[]int) []int {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]int); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 
 func (m *Map) GetFloat64Slice(key string, defaultVal ...[]float64) []float64 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]float64); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
 func (m *Map) GetFloat32Slice(key string, defaultVal ...[]float32) []float32 {
-	v := m.GetValue(key, defaultVal)
-	if val, ok := v.([]float32); ok {
-		return val
-	}
-	panic(errors.New("can't get val:" + key))
+	return mustGet(m, key, defaultVal)
 }
+
+// GetValue 获取数据，支持 Lookup 的路径，不存在且未设置 defaultVal 时 panic，
+// 不希望 panic 时使用 Lookup、Get 或 GetXxxE
 func (m *Map) GetValue(key string, defaultVal ...interface{}) interface{} {
-	if val, ok := m.data[key]; ok {
+	if val, ok := m.Lookup(key); ok {
 		return val
 	}
 	if len(defaultVal) == 1 {
@@ -195,6 +146,14 @@ func (m *Map) GetValue(key string, defaultVal ...interface{}) interface{} {
 	panic(errors.New("can't find key:" + key))
 }
 
+// MarshalJSON 输出 JSON，用于调试时查看虚拟用户的数据
+func (m *Map) MarshalJSON() ([]byte, error) {
+	if m.data == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m.data)
+}
+
 // 清空数据
 func (m *Map) Clean() {
 	for key, _ := range m.data {
@@ -0,0 +1,260 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:01
+ */
+package leadutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrKeyNotFound Map 中不存在该 key 或路径
+	ErrKeyNotFound = errors.New("map: key not found")
+	// ErrTypeMismatch Map 中的值无法转换为需要的类型
+	ErrTypeMismatch = errors.New("map: type mismatch")
+)
+
+// Lookup 获取数据，不存在时返回 false。
+// key 不存在时按路径访问嵌套的 JSON 数据，路径使用 . 分隔，数组下标使用 [n] 或 .n，
+// 可以使用 $. 开头，例如 data.items[0].id、$.data.items.0.id。
+func (m *Map) Lookup(path string) (interface{}, bool) {
+	if val, ok := m.data[path]; ok {
+		return val, true
+	}
+
+	var cur interface{} = m.data
+	for _, segment := range splitPath(path) {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			val, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			cur = val
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Has 是否存在该 key 或路径
+func (m *Map) Has(path string) bool {
+	_, ok := m.Lookup(path)
+	return ok
+}
+
+// splitPath 解析路径，data.items[0].id 解析为 data、items、0、id
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(path, ".")
+}
+
+// Get 获取数据并转换为 T，不存在时返回 ErrKeyNotFound，无法转换时返回 ErrTypeMismatch。
+// 数值类型之间会自动转换，例如 JSON 中的 float64 可以获取为 int，有小数部分或溢出时无法转换；
+// 切片按元素转换，例如 JSON 中的 []interface{} 可以获取为 []string。
+//
+//	id, err := leadutil.Get[int](&m.Data, "data.items[0].id")
+func Get[T any](m *Map, path string) (T, error) {
+	var zero T
+	v, ok := m.Lookup(path)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+	}
+	val, ok := convert[T](v)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s is %T, not %T", ErrTypeMismatch, path, v, zero)
+	}
+	return val, nil
+}
+
+// GetOr 获取数据并转换为 T，不存在或无法转换时返回 defaultVal
+func GetOr[T any](m *Map, path string, defaultVal T) T {
+	val, err := Get[T](m, path)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
+// TryGet 获取数据并转换为 T，不存在或无法转换时返回 false
+func TryGet[T any](m *Map, path string) (T, bool) {
+	val, err := Get[T](m, path)
+	return val, err == nil
+}
+
+// GetIntE 获取 int，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetIntE(path string) (int, error) {
+	return Get[int](m, path)
+}
+
+// GetInt64E 获取 int64，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetInt64E(path string) (int64, error) {
+	return Get[int64](m, path)
+}
+
+// GetFloat64E 获取 float64，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetFloat64E(path string) (float64, error) {
+	return Get[float64](m, path)
+}
+
+// GetStringE 获取 string，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetStringE(path string) (string, error) {
+	return Get[string](m, path)
+}
+
+// GetBoolE 获取 bool，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetBoolE(path string) (bool, error) {
+	return Get[bool](m, path)
+}
+
+// GetStringSliceE 获取 []string，不存在或无法转换时返回错误，见 Get
+func (m *Map) GetStringSliceE(path string) ([]string, error) {
+	return Get[[]string](m, path)
+}
+
+// GetMapE 获取嵌套的 JSON 对象，不存在或不是对象时返回错误
+func (m *Map) GetMapE(path string) (*Map, error) {
+	data, err := Get[map[string]interface{}](m, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Map{data: data}, nil
+}
+
+// mustGet 兼容原有的 GetXxx 方法，不存在时返回 defaultVal，无法转换时 panic
+func mustGet[T any](m *Map, key string, defaultVal []T) T {
+	v, ok := m.Lookup(key)
+	if !ok {
+		if len(defaultVal) == 1 {
+			return defaultVal[0]
+		}
+		panic(errors.New("can't find key:" + key))
+	}
+	if val, ok := convert[T](v); ok {
+		return val
+	}
+	panic(errors.New("can't get val:" + key))
+}
+
+// convert 将 v 转换为 T
+func convert[T any](v interface{}) (T, bool) {
+	if val, ok := v.(T); ok {
+		return val, true
+	}
+	var zero T
+	t := reflect.TypeOf(&zero).Elem()
+	rv, ok := convertValue(reflect.ValueOf(v), t)
+	if !ok {
+		return zero, false
+	}
+	return rv.Interface().(T), true
+}
+
+func convertValue(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return reflect.Value{}, false
+	}
+	if v.Kind() == reflect.Interface {
+		return convertValue(v.Elem(), t)
+	}
+	if v.Type().AssignableTo(t) {
+		return v, true
+	}
+	if n, ok := v.Interface().(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v = reflect.ValueOf(f)
+	}
+
+	switch {
+	case isNumber(v.Kind()) && isNumber(t.Kind()):
+		return convertNumber(v, t)
+	case v.Kind() == reflect.Slice && t.Kind() == reflect.Slice:
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := convertValue(v.Index(i), t.Elem())
+			if !ok {
+				return reflect.Value{}, false
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, true
+	}
+	return reflect.Value{}, false
+}
+
+// convertNumber 数值转换，浮点数转整数时需为整数值，且不能溢出
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	var f float64
+	switch {
+	case isInt(v.Kind()):
+		f = float64(v.Int())
+	case isUint(v.Kind()):
+		f = float64(v.Uint())
+	default:
+		f = v.Float()
+	}
+
+	out := reflect.New(t).Elem()
+	switch {
+	case isInt(t.Kind()):
+		if isInt(v.Kind()) {
+			if out.OverflowInt(v.Int()) {
+				return reflect.Value{}, false
+			}
+			out.SetInt(v.Int())
+			return out, true
+		}
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || out.OverflowInt(int64(f)) {
+			return reflect.Value{}, false
+		}
+		out.SetInt(int64(f))
+	case isUint(t.Kind()):
+		if isUint(v.Kind()) {
+			if out.OverflowUint(v.Uint()) {
+				return reflect.Value{}, false
+			}
+			out.SetUint(v.Uint())
+			return out, true
+		}
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || out.OverflowUint(uint64(f)) {
+			return reflect.Value{}, false
+		}
+		out.SetUint(uint64(f))
+	default:
+		if out.OverflowFloat(f) {
+			return reflect.Value{}, false
+		}
+		out.SetFloat(f)
+	}
+	return out, true
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || k == reflect.Float32 || k == reflect.Float64
+}
@@ -0,0 +1,137 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:02
+ */
+package leadutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newJSONMap() *Map {
+	m := NewMap()
+	m.UpdateWithJsonByte([]byte(`{
+		"code": 0,
+		"msg": "ok",
+		"data": {
+			"total": 2,
+			"price": 9.5,
+			"tags": ["a", "b"],
+			"items": [{"id": 101, "name": "x"}, {"id": 102, "name": "y"}]
+		}
+	}`))
+	return m
+}
+
+func TestMapGetDefault(t *testing.T) {
+	m := NewMap()
+	if v := m.GetInt("missing", 3); v != 3 {
+		t.Errorf("GetInt() = %d, want 3", v)
+	}
+	if v := m.GetString("missing", "def"); v != "def" {
+		t.Errorf("GetString() = %s, want def", v)
+	}
+	if v := m.GetStringSlice("missing", []string{"a"}); !reflect.DeepEqual(v, []string{"a"}) {
+		t.Errorf("GetStringSlice() = %v, want [a]", v)
+	}
+}
+
+func TestMapGetJSONNumber(t *testing.T) {
+	m := newJSONMap()
+	if v := m.GetInt("code"); v != 0 {
+		t.Errorf("GetInt() = %d, want 0", v)
+	}
+	if v := m.GetInt64("data.total"); v != 2 {
+		t.Errorf("GetInt64() = %d, want 2", v)
+	}
+	if v, err := m.GetIntE("data.items[1].id"); err != nil || v != 102 {
+		t.Errorf("GetIntE() = %d, %v, want 102", v, err)
+	}
+	if _, err := m.GetIntE("data.price"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("GetIntE() on 9.5 error = %v, want ErrTypeMismatch", err)
+	}
+	if v, err := m.GetFloat64E("data.price"); err != nil || v != 9.5 {
+		t.Errorf("GetFloat64E() = %v, %v, want 9.5", v, err)
+	}
+}
+
+func TestMapGetPath(t *testing.T) {
+	m := newJSONMap()
+	cases := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"msg", "ok", true},
+		{"data.items[0].name", "x", true},
+		{"$.data.items.1.name", "y", true},
+		{"data.items[2].name", nil, false},
+		{"data.tags[x]", nil, false},
+		{"msg.length", nil, false},
+		{"data.missing", nil, false},
+	}
+	for _, c := range cases {
+		v, ok := m.Lookup(c.path)
+		if ok != c.ok || (ok && v != c.want) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v, %v", c.path, v, ok, c.want, c.ok)
+		}
+	}
+
+	m.SetString("a.b", "dotted")
+	if v := m.GetString("a.b"); v != "dotted" {
+		t.Errorf("GetString() = %s, want dotted", v)
+	}
+}
+
+func TestMapGetGeneric(t *testing.T) {
+	m := newJSONMap()
+	tags, err := Get[[]string](m, "data.tags")
+	if err != nil || !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("Get[[]string]() = %v, %v", tags, err)
+	}
+	if _, err := Get[int](m, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get[int]() error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := Get[string](m, "code"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Get[string]() error = %v, want ErrTypeMismatch", err)
+	}
+	if _, err := Get[uint8](m, "data.items[0].id"); err != nil {
+		t.Errorf("Get[uint8]() error = %v", err)
+	}
+	if v := GetOr(m, "data.total", 10); v != 2 {
+		t.Errorf("GetOr() = %d, want 2", v)
+	}
+	if v := GetOr(m, "missing", 10); v != 10 {
+		t.Errorf("GetOr() = %d, want 10", v)
+	}
+	if _, ok := TryGet[int8](m, "data.items[0].id"); !ok {
+		t.Error("TryGet[int8]() should succeed for 101")
+	}
+
+	item, err := m.GetMapE("data.items[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := item.GetString("name"); v != "x" {
+		t.Errorf("GetString() = %s, want x", v)
+	}
+}
+
+func TestMapGetPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("GetInt() on missing key should panic")
+		}
+	}()
+	NewMap().GetInt("missing")
+}
+
+func TestMapZeroValue(t *testing.T) {
+	var m Map
+	m.SetInt("n", 1)
+	if v := m.GetInt("n"); v != 1 {
+		t.Errorf("GetInt() = %d, want 1", v)
+	}
+}
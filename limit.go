@@ -0,0 +1,129 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	RunTimeFlag          = flag.String("run-time", "", "stop the test after the specified amount of time since the users are spawned, example: 30s, 10m, 1h30m")
+	SharedIterationsFlag = flag.Int64("shared-iterations", 0, "total number of tasks shared by all users, the test ends when they are used up")
+)
+
+// runLimit 压测的结束条件：运行时间（Duration）、所有虚拟用户共享的任务次数（SharedIterations）
+// 与 OnStart 失败的虚拟用户数（OnStartPolicy.MaxFailures），达到任一条件时调用 end 结束压测
+type runLimit struct {
+	duration   time.Duration
+	iterations int64
+	// remaining 剩余的共享任务次数
+	remaining int64
+	// maxStartFailures、startFailures OnStart 失败的虚拟用户数上限与当前数量
+	maxStartFailures int64
+	startFailures    int64
+	end              func()
+
+	mutex   sync.Mutex
+	timer   *time.Timer
+	onSpawn func(workers int, spawnRate float64)
+	endOnce sync.Once
+}
+
+// newRunLimit 创建压测的结束条件，优先使用 Duration、SharedIterations 设置，未设置时使用命令行参数，
+// 都未设置时返回 nil，--run-time 格式错误时返回错误
+func newRunLimit(opt *option, end func()) (*runLimit, error) {
+	duration := opt.duration
+	if duration == 0 && flag.Parsed() && *RunTimeFlag != "" {
+		d, err := time.ParseDuration(*RunTimeFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run time %q: %v", *RunTimeFlag, err)
+		}
+		duration = d
+	}
+	iterations := opt.sharedIterations
+	if iterations == 0 && flag.Parsed() {
+		iterations = *SharedIterationsFlag
+	}
+	maxStartFailures := opt.onStartPolicy.MaxFailures
+	if duration <= 0 && iterations <= 0 && maxStartFailures <= 0 {
+		return nil, nil
+	}
+
+	return &runLimit{
+		duration:         duration,
+		iterations:       iterations,
+		remaining:        iterations,
+		maxStartFailures: maxStartFailures,
+		end:              end,
+	}, nil
+}
+
+// start 开始计时，运行时间从第一次启动虚拟用户时开始计算
+func (r *runLimit) start() error {
+	if r == nil || r.duration <= 0 {
+		return nil
+	}
+
+	r.onSpawn = func(workers int, spawnRate float64) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if r.timer == nil {
+			r.timer = time.AfterFunc(r.duration, func() {
+				r.finish("run time %v is up", r.duration)
+			})
+		}
+	}
+	return Events.SubscribeOnce(EventSpawn, r.onSpawn)
+}
+
+// take 获取一次共享任务次数，次数用完时结束压测并返回 false
+func (r *runLimit) take() bool {
+	if r == nil || r.iterations <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&r.remaining, -1) >= 0 {
+		return true
+	}
+	r.finish("all the %d shared iterations are done", r.iterations)
+	return false
+}
+
+// startFailed 记录一个 OnStart 失败的虚拟用户，数量达到上限时结束压测
+func (r *runLimit) startFailed() {
+	if r == nil || r.maxStartFailures <= 0 {
+		return
+	}
+	if atomic.AddInt64(&r.startFailures, 1) >= r.maxStartFailures {
+		r.finish("%d users failed to start", r.maxStartFailures)
+	}
+}
+
+// finish 结束压测，仅执行一次
+func (r *runLimit) finish(format string, a ...interface{}) {
+	r.endOnce.Do(func() {
+		log.Printf(format+", stop the test\n", a...)
+		go r.end()
+	})
+}
+
+// close 压测结束后停止计时
+func (r *runLimit) close() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	if r.onSpawn != nil {
+		_ = Events.Unsubscribe(EventSpawn, r.onSpawn)
+	}
+}
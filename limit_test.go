@@ -0,0 +1,215 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// endCounter 统计结束压测的次数
+type endCounter struct {
+	ends  int32
+	ended chan struct{}
+}
+
+func newEndCounter() *endCounter {
+	return &endCounter{ended: make(chan struct{}, 10)}
+}
+
+func (c *endCounter) end() {
+	atomic.AddInt32(&c.ends, 1)
+	c.ended <- struct{}{}
+}
+
+// wait 等待结束压测，超时返回 false
+func (c *endCounter) wait(timeout time.Duration) bool {
+	select {
+	case <-c.ended:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestNewRunLimit(t *testing.T) {
+	oldRunTime, oldIterations := *RunTimeFlag, *SharedIterationsFlag
+	defer func() {
+		*RunTimeFlag, *SharedIterationsFlag = oldRunTime, oldIterations
+	}()
+
+	tests := []struct {
+		name           string
+		opts           []Option
+		runTime        string
+		iterations     int64
+		nilLimit       bool
+		wantErr        bool
+		wantDuration   time.Duration
+		wantIterations int64
+	}{
+		{name: "no limit", nilLimit: true},
+		{name: "options", opts: []Option{Duration("1m"), SharedIterations(100)}, wantDuration: time.Minute, wantIterations: 100},
+		{name: "flags", runTime: "30s", iterations: 10, wantDuration: 30 * time.Second, wantIterations: 10},
+		{name: "options first", opts: []Option{Duration("1m"), SharedIterations(100)}, runTime: "30s", iterations: 10, wantDuration: time.Minute, wantIterations: 100},
+		{name: "invalid run time", runTime: "1x", wantErr: true},
+		{name: "invalid run time with options", opts: []Option{Duration("1m")}, runTime: "1x", wantDuration: time.Minute},
+		{name: "max start failures", opts: []Option{OnStartFailure(OnStartPolicy{MaxFailures: 3})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*RunTimeFlag, *SharedIterationsFlag = tt.runTime, tt.iterations
+			r, err := newRunLimit(New(tt.opts...).option, func() {})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRunLimit() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.nilLimit || tt.wantErr {
+				if r != nil {
+					t.Fatalf("newRunLimit() = %+v, want nil", r)
+				}
+				return
+			}
+			if r == nil {
+				t.Fatal("newRunLimit() = nil")
+			}
+			if r.duration != tt.wantDuration || r.iterations != tt.wantIterations {
+				t.Fatalf("duration %v, iterations %d, want %v and %d", r.duration, r.iterations, tt.wantDuration, tt.wantIterations)
+			}
+		})
+	}
+}
+
+func TestRunLimitNil(t *testing.T) {
+	var r *runLimit
+	if err := r.start(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.take() {
+		t.Fatal("take() of no limit = false")
+	}
+	r.startFailed()
+	r.close()
+}
+
+func TestRunLimitSharedIterations(t *testing.T) {
+	c := newEndCounter()
+	r := &runLimit{iterations: 3, remaining: 3, end: c.end}
+	for i := 0; i < 3; i++ {
+		if !r.take() {
+			t.Fatalf("take() #%d = false", i+1)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if r.take() {
+			t.Fatal("take() after all the iterations are used up = true")
+		}
+	}
+	if !c.wait(time.Second) {
+		t.Fatal("test is not ended")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&c.ends); n != 1 {
+		t.Fatalf("test is ended %d times", n)
+	}
+}
+
+func TestRunLimitStartFailures(t *testing.T) {
+	c := newEndCounter()
+	r := &runLimit{maxStartFailures: 2, end: c.end}
+	r.startFailed()
+	if c.wait(20 * time.Millisecond) {
+		t.Fatal("test is ended before max start failures")
+	}
+	r.startFailed()
+	r.startFailed()
+	if !c.wait(time.Second) {
+		t.Fatal("test is not ended after max start failures")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&c.ends); n != 1 {
+		t.Fatalf("test is ended %d times", n)
+	}
+}
+
+func TestRunLimitDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		spawn bool
+		close bool
+		ended bool
+	}{
+		{name: "timer starts after spawning", spawn: true, ended: true},
+		{name: "no timer before spawning"},
+		{name: "closed before the time is up", spawn: true, close: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newEndCounter()
+			r := &runLimit{duration: 50 * time.Millisecond, end: c.end}
+			if err := r.start(); err != nil {
+				t.Fatal(err)
+			}
+			defer r.close()
+			if tt.spawn {
+				Events.Publish(EventSpawn, 1, float64(1))
+			}
+			if tt.close {
+				r.close()
+			}
+			if ended := c.wait(300 * time.Millisecond); ended != tt.ended {
+				t.Fatalf("ended = %v, want %v", ended, tt.ended)
+			}
+		})
+	}
+}
+
+func TestLeadLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+		// runs 执行的任务数，为0时不检查
+		runs int64
+	}{
+		{name: "duration", opt: Duration("200ms")},
+		{name: "shared iterations", opt: SharedIterations(20), runs: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var finished, runs int64
+			l := New(Interval("10ms"), tt.opt)
+			l.ResetLine(func() ILine {
+				line := &pingLine{Line: NewLine(), finished: &finished}
+				line.AddWeightFunc(func() { atomic.AddInt64(&runs, 1) }, 1)
+				return line
+			})
+			if err := l.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Scale(2, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				l.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				l.Stop()
+				t.Fatal("test is not ended by the limit")
+			}
+			if n := atomic.LoadInt64(&finished); n != 2 {
+				t.Fatalf("OnFinish called %d times, want 2", n)
+			}
+			if n := atomic.LoadInt64(&runs); tt.runs > 0 && n != tt.runs {
+				t.Fatalf("%d tasks run, want %d", n, tt.runs)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package navigator
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -41,6 +42,16 @@ type StatusLine interface {
 	ChangeStatus(status int)
 }
 
+// StoreSetter 使用共享数据的虚拟用户，Lead 创建虚拟用户后通过 SetStore 设置共享数据
+type StoreSetter interface {
+	SetStore(store *leadutil.Store)
+}
+
+// FixtureSetter 使用测试数据的虚拟用户，Lead 创建虚拟用户后通过 SetFixture 设置 OnTestStart 返回的测试数据
+type FixtureSetter interface {
+	SetFixture(fixture interface{})
+}
+
 // LeadLine 引火线接口
 type Liner interface {
 	ILine
@@ -57,14 +68,39 @@ const (
 )
 
 type Line struct {
-	// 虚拟用户权重
-	// TODO: 后续实现多类型用户测试
+	// 虚拟用户权重，多类虚拟用户时，按权重比例分配虚拟用户数量
 	weight      int
 	tasks       []*Task
 	n           int
 	status      int
 	orderStatus bool
-	HTTPClient  *leadutil.FastHTTPClient
+	// taskSets 虚拟用户当前进入的任务集合，最后一个为当前执行的任务集合
+	taskSets []*TaskSet
+	// 场景阶段，见 scenario.go
+	setupTasks    []*Task
+	teardownTasks []*Task
+	phase         int
+	phaseIndex    int
+	// sequential 主阶段按添加顺序执行任务
+	sequential bool
+	// iterations 主阶段执行次数，0 表示一直执行
+	iterations int
+	iteration  int
+	index      int
+
+	waitTime WaitTimeFunc
+	// middlewareList 任务中间件，见 Use
+	middlewareList []Middleware
+	// taskErr 最近一次任务的执行结果
+	taskErr error
+	// held 虚拟用户持有的资源，虚拟用户结束时归还
+	held []leadutil.Releaser
+	// store 所有虚拟用户共享的数据，由 Lead 设置
+	store *leadutil.Store
+	// fixture OnTestStart 返回的测试数据，由 Lead 设置
+	fixture interface{}
+
+	HTTPClient *leadutil.FastHTTPClient
 }
 
 func NewLine() *Line {
@@ -106,19 +142,45 @@ func (l *Line) Weight() int {
 	return l.weight
 }
 
+// SetWeight 设置虚拟用户权重，一般在构造方法中设置
+func (l *Line) SetWeight(weight int) {
+	l.weight = weight
+}
+
+// SetWaitTime 设置虚拟用户自己的等待时间策略，一般在构造方法中设置
+func (l *Line) SetWaitTime(waitTime WaitTimeFunc) {
+	l.waitTime = waitTime
+}
+
+// WaitTime 虚拟用户的等待时间策略，未设置时返回 nil，使用 Lead 的等待时间设置
+func (l *Line) WaitTime() WaitTimeFunc {
+	return l.waitTime
+}
+
 // Init 虚拟用户初始化
 func (l *Line) Init() {
 	l.status = StatusNormal
 	l.n = len(l.tasks)
-	rand.Shuffle(
-		l.n, func(i, j int) {
-			l.tasks[i], l.tasks[j] = l.tasks[j], l.tasks[i]
-		},
-	)
+	if !l.sequential {
+		rand.Shuffle(
+			l.n, func(i, j int) {
+				l.tasks[i], l.tasks[j] = l.tasks[j], l.tasks[i]
+			},
+		)
+	}
 
+	visited := map[*TaskSet]bool{}
 	for _, t := range l.tasks {
 		t.EffectiveWeight = t.Weight
+		if t.TaskSet != nil {
+			t.TaskSet.init(visited)
+		}
 	}
+	l.taskSets = nil
+	l.phase = phaseSetup
+	l.phaseIndex = 0
+	l.index = 0
+	l.iteration = 0
 
 	if l.weight == 0 {
 		l.weight = 1
@@ -139,6 +201,50 @@ func (l *Line) Skip() {
 	l.status = StatusSkip
 }
 
+// Fail 将当前任务标记为失败，中间件中可以通过 TaskContext.Err 获取，
+// 开启 EnableTaskStats 时该任务记录为失败，err 为空时不做处理。
+// l.Fail(err)
+// return
+func (l *Line) Fail(err error) {
+	if err != nil {
+		l.taskErr = err
+	}
+}
+
+// SetStore 设置共享数据，由 Lead 在创建虚拟用户后调用
+func (l *Line) SetStore(store *leadutil.Store) {
+	l.store = store
+}
+
+// Store 所有虚拟用户共享的并发安全数据，例如共用的登录 token、订单计数，
+// 未通过 Lead 运行时返回 nil
+func (l *Line) Store() *leadutil.Store {
+	return l.store
+}
+
+// SetFixture 设置测试数据，由 Lead 在创建虚拟用户后调用
+func (l *Line) SetFixture(fixture interface{}) {
+	l.fixture = fixture
+}
+
+// Fixture OnTestStart 返回的测试数据，所有虚拟用户共用同一个对象，可以使用 FixtureOf 获取指定类型的测试数据
+func (l *Line) Fixture() interface{} {
+	return l.fixture
+}
+
+// Hold 持有资源，如 leadutil.LeasePool 获取的资源，虚拟用户结束（包括中断、停止）时，在 OnFinish 之后自动归还
+func (l *Line) Hold(releasers ...leadutil.Releaser) {
+	l.held = append(l.held, releasers...)
+}
+
+// releaseHeld 归还持有的资源
+func (l *Line) releaseHeld() {
+	for _, releaser := range l.held {
+		releaser.Release()
+	}
+	l.held = nil
+}
+
 // Status 用于 Lead 检查 Line 状态
 func (l *Line) Status() int {
 	return l.status
@@ -164,7 +270,6 @@ func (l *Line) nextWeighted() *Task {
 // 遍历所有任务权重,执行权重高任务,执行后该任务当前权重会被减去所有任务权重,以此计算任务执行概率
 // todo (best *Task) 带指针 直接用指针.属性的方式，会修改原地址的值,所以原本的Task的任务权重会受自此数据变动
 func (l *Line) nextSmoothWeighted() (best *Task) {
-	total := 0
 	if !l.orderStatus {
 		// 先执行一次排序
 		oldOrder := 9999
@@ -185,30 +290,7 @@ func (l *Line) nextSmoothWeighted() (best *Task) {
 			l.orderStatus = true
 		}
 	}
-	for i := 0; i < l.n; i++ {
-		w := l.tasks[i]
-		if w == nil {
-			continue
-		}
-		w.CurrentWeight += w.EffectiveWeight
-		total += w.EffectiveWeight
-		// 这段if为无效代码块
-		if w.EffectiveWeight < w.Weight {
-			w.EffectiveWeight++
-		}
-
-		if best == nil || w.CurrentWeight > best.CurrentWeight {
-			best = w
-		}
-
-	}
-
-	if best == nil {
-		return nil
-	}
-	// 修改原数据的当前任务权重,并返回执行该任务
-	best.CurrentWeight -= total
-	return best
+	return smoothWeighted(l.tasks)
 }
 
 // getWeightSum 获取任务权重
@@ -219,14 +301,33 @@ func (l *Line) getWeightSum() (weightSum int) {
 	return weightSum
 }
 
-// AddWeightFunc 添加任务函数，并设置权重
-func (l *Line) AddWeightFunc(fn func(), weight int, order ...int) {
-	l.AddTask(&Task{
+// AddWeightFunc 添加任务函数，并设置权重，返回添加的任务，可以通过 Tag 添加标签
+func (l *Line) AddWeightFunc(fn func(), weight int, order ...int) *Task {
+	task := &Task{
 		Weight: weight,
 		Order:  l.getOrderFunc(order...),
 		Fn:     l.safeFn(fn),
 		Name:   runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
-	})
+	}
+	l.AddTask(task)
+	return task
+}
+
+// AddWeightFuncCtx 添加支持 context 的任务函数，并设置权重，返回添加的任务，
+// 虚拟用户停止、缩容或任务超时时，ctx 被取消
+func (l *Line) AddWeightFuncCtx(fn func(ctx context.Context), weight int, order ...int) *Task {
+	safeFnCtx := l.safeFnCtx(fn)
+	task := &Task{
+		Weight: weight,
+		Order:  l.getOrderFunc(order...),
+		Fn: func() {
+			safeFnCtx(context.Background())
+		},
+		FnCtx: safeFnCtx,
+		Name:  runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
+	}
+	l.AddTask(task)
+	return task
 }
 
 // 获取任务顺序
@@ -249,6 +350,7 @@ func (l *Line) safeFn(fn func()) func() {
 				os.Stderr.Write([]byte("\n"))
 				os.Stderr.Write(stackTrace)
 				l.OnError("Run Panic", errors.New(errMsg+"\n"+string(stackTrace)))
+				l.taskErr = errors.New(errMsg)
 			}
 		}()
 
@@ -256,18 +358,132 @@ func (l *Line) safeFn(fn func()) func() {
 	}
 }
 
+func (l *Line) safeFnCtx(fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		l.safeFn(func() {
+			fn(ctx)
+		})()
+	}
+}
+
 // AddTask 添加任务
 func (l *Line) AddTask(task ...*Task) {
 	l.tasks = append(l.tasks, task...)
 }
 
 // Next returns next selected task.
+// 按 setup、主阶段、teardown 的顺序选择任务，主阶段的任务为任务集合时，进入该任务集合，
+// 并从该任务集合中选择任务，直到调用 InterruptTaskSet 返回上一级。
+// 所有阶段执行完成后，中断该虚拟用户并返回 nil。
 func (l *Line) Next() *Task {
-	i := l.nextWeighted()
-	if i == nil {
+	if l.phase == phaseSetup {
+		if l.phaseIndex < len(l.setupTasks) {
+			l.phaseIndex++
+			return l.setupTasks[l.phaseIndex-1]
+		}
+		l.phase = phaseMain
+	}
+
+	if l.phase == phaseMain {
+		if !l.mainFinished() {
+			// 退出任务集合后主阶段可能刚好执行完成
+			if i := l.nextMain(); i != nil || !l.mainFinished() {
+				return i
+			}
+		}
+		l.phase = phaseTeardown
+		l.phaseIndex = 0
+		l.taskSets = nil
+	}
+
+	if l.phase == phaseTeardown {
+		if l.phaseIndex < len(l.teardownTasks) {
+			l.phaseIndex++
+			return l.teardownTasks[l.phaseIndex-1]
+		}
+		l.phase = phaseDone
+	}
+
+	l.Interrupt()
+	return nil
+}
+
+// nextMain 选择主阶段的下一个任务
+func (l *Line) nextMain() *Task {
+	for {
+		var i *Task
+		if n := len(l.taskSets); n > 0 {
+			taskSet := l.taskSets[n-1]
+			i = taskSet.next()
+			if i == nil && taskSet.finished() {
+				// 顺序任务集合执行完成，自动返回上一级
+				l.taskSets = l.taskSets[:n-1]
+				if l.mainFinished() {
+					return nil
+				}
+				continue
+			}
+		} else if l.sequential {
+			i = l.nextSequential()
+		} else {
+			i = l.nextWeighted()
+		}
+
+		if i != nil && i.TaskSet != nil {
+			i.TaskSet.reset()
+			l.taskSets = append(l.taskSets, i.TaskSet)
+			continue
+		}
+
+		if i != nil && !l.sequential {
+			l.iteration++
+		}
+		return i
+	}
+}
+
+// NewTaskSet 创建属于该虚拟用户的任务集合，
+// 任务集合需通过 AddTaskSet 添加到虚拟用户或其他任务集合中。
+func (l *Line) NewTaskSet(name string) *TaskSet {
+	return &TaskSet{
+		Name: name,
+		line: l,
+	}
+}
+
+// AddTaskSet 添加任务集合，并设置权重，返回添加的任务，任务的标签对集合内的所有任务生效。
+// 虚拟用户选中该任务集合后，进入该任务集合，按权重执行任务集合内的任务，
+// 直到在任务中调用 InterruptTaskSet 返回上一级，类似 locust 中 TaskSet 的 interrupt。
+// 任务集合需先添加任务，为空时虚拟用户进入后无任务可执行，此时不添加并返回 nil。
+func (l *Line) AddTaskSet(taskSet *TaskSet, weight int) *Task {
+	if taskSet == nil || len(taskSet.tasks) == 0 {
 		return nil
 	}
-	return i
+	task := &Task{
+		Weight:  weight,
+		Name:    taskSet.Name,
+		TaskSet: taskSet,
+	}
+	l.AddTask(task)
+	return task
+}
+
+// InterruptTaskSet 退出当前任务集合，返回上一级任务集合继续执行，虚拟用户不会中断。
+// 未进入任务集合时不做处理。
+// l.InterruptTaskSet()
+// return
+func (l *Line) InterruptTaskSet() {
+	if n := len(l.taskSets); n > 0 {
+		l.taskSets = l.taskSets[:n-1]
+	}
+}
+
+// CurrentTaskSet 当前执行的任务集合，未进入任务集合时返回 nil
+func (l *Line) CurrentTaskSet() *TaskSet {
+	if n := len(l.taskSets); n > 0 {
+		return l.taskSets[n-1]
+	}
+	return nil
 }
 
 // SimpleLine 我们自定义的虚拟用户结构
@@ -304,6 +520,22 @@ func CreateSimpleLine() *SimpleLine {
 	return mt
 }
 
+// holdLine 持有资源的虚拟用户，*Line 已实现
+type holdLine interface {
+	releaseHeld()
+}
+
+// ReleaseHeld 归还虚拟用户通过 Hold 持有的资源，Lead 在 OnFinish 之后自动调用，
+// 不通过 Lead 运行虚拟用户时（例如单元测试）需手动调用
+func ReleaseHeld(line ILine) {
+	if w, ok := line.(*wrapLine); ok {
+		line = w.ILine
+	}
+	if h, ok := line.(holdLine); ok {
+		h.releaseHeld()
+	}
+}
+
 // wrapLine 对于不支持 LineStatus 的，进行处理
 type wrapLine struct {
 	ILine
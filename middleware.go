@@ -0,0 +1,142 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"github.com/Hellowlonewolf/navigator/internal/runtask"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"strings"
+	"time"
+)
+
+// TaskRequestType EnableTaskStats 记录任务统计数据时使用的请求类型
+const TaskRequestType = "task"
+
+// TaskContext 任务执行信息，在中间件之间传递
+type TaskContext struct {
+	// Ctx 任务的 ctx，中间件可以替换后再调用 next，例如添加超时或追踪信息
+	Ctx context.Context
+	// Task 执行的任务，任务名为 Task.Name
+	Task *Task
+	// Line 执行任务的虚拟用户
+	Line ILine
+	// Err 任务执行结果，任务 panic 或调用 Line.Fail 时不为空，调用 next 后可用
+	Err error
+}
+
+// TaskHandler 任务执行函数
+type TaskHandler func(tc *TaskContext)
+
+// Middleware 任务中间件，返回的 TaskHandler 中调用 next 执行后续中间件及任务，
+// 可以在 next 前后添加处理逻辑，例如计时、日志、重试、限流，不调用 next 时任务不执行。
+//
+//	func Logger(next navigator.TaskHandler) navigator.TaskHandler {
+//		return func(tc *navigator.TaskContext) {
+//			next(tc)
+//			log.Println(tc.Task.Name, tc.Err)
+//		}
+//	}
+type Middleware func(next TaskHandler) TaskHandler
+
+// middlewareLine 支持中间件的虚拟用户，*Line 已实现
+type middlewareLine interface {
+	middlewares() []Middleware
+}
+
+// taskErrLine 记录任务执行结果的虚拟用户，*Line 已实现
+type taskErrLine interface {
+	takeTaskErr() error
+}
+
+// Use 添加所有虚拟用户的任务中间件，先添加的中间件先执行，
+// Lead 的中间件在虚拟用户自己的中间件之前执行。
+func (l *Lead) Use(middlewares ...Middleware) {
+	l.middlewares = append(l.middlewares, middlewares...)
+}
+
+// Use 添加该虚拟用户的任务中间件，先添加的中间件先执行，一般在构造方法中添加。
+func (l *Line) Use(middlewares ...Middleware) {
+	l.middlewareList = append(l.middlewareList, middlewares...)
+}
+
+func (l *Line) middlewares() []Middleware {
+	return l.middlewareList
+}
+
+// takeTaskErr 获取并清除最近一次任务的执行结果
+func (l *Line) takeTaskErr() error {
+	err := l.taskErr
+	l.taskErr = nil
+	return err
+}
+
+// taskHandler 创建虚拟用户执行任务的函数，依次经过 Lead 与虚拟用户的中间件，最后执行任务
+func (l *Lead) taskHandler(line ILine, timeout time.Duration) TaskHandler {
+	errLine, ok := line.(taskErrLine)
+	handler := func(tc *TaskContext) {
+		if ok {
+			// 清除任务外调用 Fail 的结果
+			errLine.takeTaskErr()
+		}
+		tc.Task.run(tc.Ctx, timeout)
+		if ok {
+			tc.Err = errLine.takeTaskErr()
+		}
+	}
+
+	var middlewares []Middleware
+	middlewares = append(middlewares, l.middlewares...)
+	if m, ok := line.(middlewareLine); ok {
+		middlewares = append(middlewares, m.middlewares()...)
+	}
+	if l.option.enableTaskStats {
+		middlewares = append(middlewares, recordTask)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func init() {
+	runtask.RunTask = func(ctx context.Context, lead, line, task interface{}) error {
+		return lead.(*Lead).runTask(ctx, line.(ILine), task.(*Task))
+	}
+}
+
+// runTask 执行虚拟用户的一个任务，依次经过 Lead 与虚拟用户的中间件，返回任务执行结果，
+// 用于单元测试等不通过 Run 执行任务的场景，navigatortest 包通过 runtask.RunTask 调用
+func (l *Lead) runTask(ctx context.Context, line ILine, task *Task) error {
+	tc := &TaskContext{Ctx: ctx, Task: task, Line: line}
+	l.taskHandler(line, l.option.taskTimeout)(tc)
+	return tc.Err
+}
+
+// recordTask 记录任务执行时间，任务 panic 或调用 Fail 时记录为失败，
+// 作为最后一个中间件，仅包含任务本身的执行时间
+func recordTask(next TaskHandler) TaskHandler {
+	return func(tc *TaskContext) {
+		now := time.Now()
+		next(tc)
+		elapsed := leadutil.GetElapsedMS(now)
+
+		name := taskStatsName(tc.Task.Name)
+		if tc.Err != nil {
+			leadutil.RecordFailure(TaskRequestType, name, elapsed, tc.Err.Error())
+		} else {
+			leadutil.RecordSuccess(TaskRequestType, name, elapsed, 0)
+		}
+	}
+}
+
+// taskStatsName 任务统计名称，去掉函数名中的包路径与方法值后缀，
+// 例如 github.com/xx/gotest.(*MyTask).Order-fm 为 gotest.(*MyTask).Order
+func taskStatsName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
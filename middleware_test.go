@@ -0,0 +1,233 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// record 一条请求数据
+type record struct {
+	requestType string
+	name        string
+	failure     string
+}
+
+// recorder 替换 leadutil.RecordSuccess、RecordFailure，记录请求数据，测试结束后恢复
+type recorder struct {
+	mutex   sync.Mutex
+	records []record
+}
+
+func newRecorder(t *testing.T) *recorder {
+	r := &recorder{}
+	oldSuccess, oldFailure := leadutil.RecordSuccess, leadutil.RecordFailure
+	leadutil.RecordSuccess = func(requestType, name string, responseTime int64, responseLength int64) {
+		r.add(record{requestType: requestType, name: name})
+	}
+	leadutil.RecordFailure = func(requestType, name string, responseTime int64, exception string) {
+		r.add(record{requestType: requestType, name: name, failure: exception})
+	}
+	t.Cleanup(func() {
+		leadutil.RecordSuccess, leadutil.RecordFailure = oldSuccess, oldFailure
+	})
+	return r
+}
+
+func (r *recorder) add(rec record) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.records = append(r.records, rec)
+}
+
+func (r *recorder) get() []record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]record{}, r.records...)
+}
+
+// traceMiddleware 在 next 前后记录中间件名
+func traceMiddleware(trace *[]string, name string) Middleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(tc *TaskContext) {
+			*trace = append(*trace, name+" before")
+			next(tc)
+			*trace = append(*trace, name+" after")
+		}
+	}
+}
+
+type ctxKey struct{}
+
+func TestMiddlewareChain(t *testing.T) {
+	var trace []string
+	lead := New()
+	lead.Use(traceMiddleware(&trace, "lead1"), traceMiddleware(&trace, "lead2"))
+	line := NewLine()
+	line.Use(traceMiddleware(&trace, "line"))
+	task := line.AddWeightFunc(func() { trace = append(trace, "task") }, 1)
+
+	if err := lead.runTask(context.Background(), line, task); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"lead1 before", "lead2 before", "line before", "task", "line after", "lead2 after", "lead1 after"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %q, want %q", trace, want)
+	}
+}
+
+func TestMiddlewareContextAndSkip(t *testing.T) {
+	lead := New()
+	skip := false
+	lead.Use(func(next TaskHandler) TaskHandler {
+		return func(tc *TaskContext) {
+			if skip {
+				return
+			}
+			tc.Ctx = context.WithValue(tc.Ctx, ctxKey{}, "traced")
+			next(tc)
+		}
+	})
+
+	line := NewLine()
+	var value interface{}
+	runs := 0
+	task := line.AddWeightFuncCtx(func(ctx context.Context) {
+		runs++
+		value = ctx.Value(ctxKey{})
+	}, 1)
+
+	if err := lead.runTask(context.Background(), line, task); err != nil {
+		t.Fatal(err)
+	}
+	if value != "traced" {
+		t.Fatalf("ctx value = %v, want the ctx replaced by the middleware", value)
+	}
+	// 不调用 next 时任务不执行
+	skip = true
+	if err := lead.runTask(context.Background(), line, task); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Fatalf("task runs %d times, want 1", runs)
+	}
+}
+
+func TestMiddlewareTaskErr(t *testing.T) {
+	errOrder := errors.New("order failed")
+	tests := []struct {
+		name    string
+		fn      func(l *Line)
+		wantErr string
+	}{
+		{name: "success", fn: func(l *Line) {}},
+		{name: "fail", fn: func(l *Line) { l.Fail(errOrder) }, wantErr: errOrder.Error()},
+		{name: "fail with nil", fn: func(l *Line) { l.Fail(nil) }},
+		{name: "panic", fn: func(l *Line) { panic("boom") }, wantErr: "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lead := New()
+			var got error
+			lead.Use(func(next TaskHandler) TaskHandler {
+				return func(tc *TaskContext) {
+					next(tc)
+					got = tc.Err
+				}
+			})
+			line := NewLine()
+			task := line.AddWeightFunc(func() { tt.fn(line) }, 1)
+			// 任务外调用 Fail 的结果不计入任务
+			line.Fail(errors.New("outside the task"))
+
+			err := lead.runTask(context.Background(), line, task)
+			if fmt.Sprint(err) != fmt.Sprint(got) {
+				t.Fatalf("runTask() = %v, middleware got %v", err, got)
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("runTask() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type statsLine struct {
+	*Line
+}
+
+func (l *statsLine) Order() {}
+
+func (l *statsLine) Pay() {
+	l.Fail(errors.New("no balance"))
+}
+
+func TestTaskStats(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		task func(l *statsLine) *Task
+		want []record
+	}{
+		{
+			name: "disabled",
+			task: func(l *statsLine) *Task { return l.AddWeightFunc(l.Order, 1) },
+		},
+		{
+			name: "success",
+			opts: []Option{EnableTaskStats()},
+			task: func(l *statsLine) *Task { return l.AddWeightFunc(l.Order, 1) },
+			want: []record{{requestType: TaskRequestType, name: "navigator.(*statsLine).Order"}},
+		},
+		{
+			name: "failure",
+			opts: []Option{EnableTaskStats()},
+			task: func(l *statsLine) *Task { return l.AddWeightFunc(l.Pay, 1) },
+			want: []record{{requestType: TaskRequestType, name: "navigator.(*statsLine).Pay", failure: "no balance"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRecorder(t)
+			lead := New(tt.opts...)
+			// 任务统计在所有中间件之后，中间件记录的数据在任务统计之后
+			lead.Use(func(next TaskHandler) TaskHandler {
+				return func(tc *TaskContext) {
+					next(tc)
+					leadutil.RecordSuccess("middleware", "after", 0, 0)
+				}
+			})
+			line := &statsLine{Line: NewLine()}
+			task := tt.task(line)
+			_ = lead.runTask(context.Background(), line, task)
+
+			want := append(tt.want, record{requestType: "middleware", name: "after"})
+			if got := r.get(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("records = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTaskStatsName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "github.com/xx/gotest.(*MyTask).Order-fm", want: "gotest.(*MyTask).Order"},
+		{name: "gotest.Order", want: "gotest.Order"},
+		{name: "github.com/xx/gotest.glob..func1", want: "gotest.glob..func1"},
+	}
+	for _, tt := range tests {
+		if got := taskStatsName(tt.name); got != tt.want {
+			t.Errorf("taskStatsName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
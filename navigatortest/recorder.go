@@ -0,0 +1,165 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigatortest
+
+import (
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Sample 一条记录的请求数据
+type Sample struct {
+	RequestType string
+	Name        string
+	// ResponseTime 响应时间，单位毫秒
+	ResponseTime   int64
+	ResponseLength int64
+	// Success 为 false 时为失败数据，Err 为失败原因
+	Success bool
+	Err     string
+}
+
+// recording 记录函数的持有者，同一时间只有一个测试替换 leadutil 的记录函数
+var recording struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	owner testing.TB
+	refs  int
+}
+
+func init() {
+	recording.cond = sync.NewCond(&recording.mutex)
+}
+
+// hold 等待其他测试的 Recorder 全部结束后持有记录函数，同一个测试可以重复持有。
+// 父测试持有时子测试等待会死锁，此时子测试失败
+func hold(t testing.TB) {
+	recording.mutex.Lock()
+	defer recording.mutex.Unlock()
+	for recording.owner != nil && recording.owner != t {
+		if strings.HasPrefix(t.Name(), recording.owner.Name()+"/") {
+			t.Fatalf("navigatortest: parent test %s holds a Recorder, create the Recorder in the subtests only", recording.owner.Name())
+		}
+		recording.cond.Wait()
+	}
+	recording.owner = t
+	recording.refs++
+}
+
+func release() {
+	recording.mutex.Lock()
+	defer recording.mutex.Unlock()
+	recording.refs--
+	if recording.refs == 0 {
+		recording.owner = nil
+		recording.cond.Broadcast()
+	}
+}
+
+// Recorder 记录 leadutil.RecordSuccess、leadutil.RecordFailure 的请求数据。
+// Recorder 替换全局的记录函数，并行执行的测试创建 Recorder 时依次等待前一个测试结束，
+// 同一个测试可以创建多个 Recorder；父测试持有 Recorder 时子测试不能再创建，创建时子测试失败。
+type Recorder struct {
+	mutex   sync.Mutex
+	samples []Sample
+}
+
+// NewRecorder 创建 Recorder，并替换 leadutil 的记录函数，测试结束时恢复
+func NewRecorder(t testing.TB) *Recorder {
+	hold(t)
+	r := &Recorder{}
+	recordSuccess, recordFailure := leadutil.RecordSuccess, leadutil.RecordFailure
+	leadutil.RecordSuccess = r.RecordSuccess
+	leadutil.RecordFailure = r.RecordFailure
+	t.Cleanup(func() {
+		leadutil.RecordSuccess, leadutil.RecordFailure = recordSuccess, recordFailure
+		release()
+	})
+	return r
+}
+
+// RecordSuccess 记录成功数据，同 leadutil.RecordSuccess
+func (r *Recorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.add(Sample{
+		RequestType:    requestType,
+		Name:           name,
+		ResponseTime:   responseTime,
+		ResponseLength: responseLength,
+		Success:        true,
+	})
+}
+
+// RecordFailure 记录失败数据，同 leadutil.RecordFailure
+func (r *Recorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.add(Sample{
+		RequestType:  requestType,
+		Name:         name,
+		ResponseTime: responseTime,
+		Err:          exception,
+	})
+}
+
+func (r *Recorder) add(sample Sample) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.samples = append(r.samples, sample)
+}
+
+// Samples 所有记录的数据，按记录顺序
+func (r *Recorder) Samples() []Sample {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Sample{}, r.samples...)
+}
+
+// Successes 成功数据
+func (r *Recorder) Successes() []Sample {
+	return r.filter(func(s Sample) bool { return s.Success })
+}
+
+// Failures 失败数据
+func (r *Recorder) Failures() []Sample {
+	return r.filter(func(s Sample) bool { return !s.Success })
+}
+
+// Named 名称为 name 的数据
+func (r *Recorder) Named(name string) []Sample {
+	return r.filter(func(s Sample) bool { return s.Name == name })
+}
+
+// Reset 清除记录的数据
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.samples = nil
+}
+
+func (r *Recorder) filter(fn func(s Sample) bool) []Sample {
+	var samples []Sample
+	for _, s := range r.Samples() {
+		if fn(s) {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// AssertNoFailures 断言没有记录失败数据
+func (r *Recorder) AssertNoFailures(t testing.TB) {
+	t.Helper()
+	for _, s := range r.Failures() {
+		t.Errorf("recorded failure: %s %s %dms: %s", s.RequestType, s.Name, s.ResponseTime, s.Err)
+	}
+}
+
+// AssertRecorded 断言名称为 name 的数据记录了 n 条
+func (r *Recorder) AssertRecorded(t testing.TB, name string, n int) {
+	t.Helper()
+	if got := len(r.Named(name)); got != n {
+		t.Errorf("%s recorded %d times, want %d", name, got, n)
+	}
+}
@@ -0,0 +1,58 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigatortest
+
+import (
+	"fmt"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"testing"
+	"time"
+)
+
+func TestRecorderParallel(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("/user%d", i)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := NewRecorder(t)
+			for j := 0; j < 10; j++ {
+				leadutil.RecordSuccess("http", name, 1, 10)
+				time.Sleep(time.Millisecond)
+			}
+			if samples := r.Samples(); len(samples) != 10 || len(r.Named(name)) != 10 {
+				t.Fatalf("Samples() = %v, want only the samples of %s", samples, name)
+			}
+		})
+	}
+}
+
+func TestRecorderNested(t *testing.T) {
+	first := NewRecorder(t)
+	second := NewRecorder(t)
+	leadutil.RecordFailure("http", "/order", 1, "500")
+	if len(first.Samples()) != 0 || len(second.Failures()) != 1 {
+		t.Fatalf("first %v, second %v", first.Samples(), second.Samples())
+	}
+}
+
+func TestRecorderSubtest(t *testing.T) {
+	NewRecorder(t)
+	t.Run("subtest", func(t *testing.T) {
+		fake := &fakeTB{TB: t}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			NewRecorder(fake)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("NewRecorder() in the subtest waits for the parent test forever")
+		}
+		if len(fake.errors) != 1 {
+			t.Errorf("NewRecorder() reported %q, want the parent test holding a Recorder", fake.errors)
+		}
+	})
+}
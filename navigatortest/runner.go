@@ -0,0 +1,165 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigatortest
+
+import (
+	"context"
+	"github.com/Hellowlonewolf/navigator"
+	"github.com/Hellowlonewolf/navigator/internal/runtask"
+	"strings"
+	"testing"
+)
+
+// TaskResult 一次任务的执行结果
+type TaskResult struct {
+	Task *navigator.Task
+	// Err 任务 panic 或调用 Line.Fail 时不为空
+	Err error
+}
+
+// Runner 在单元测试中按确定的顺序驱动一个虚拟用户，不启动 boomer，任务之间不等待。
+//
+//	func TestMyTask(t *testing.T) {
+//		r := navigatortest.NewRunner(t, NewMyTask())
+//		if err := r.Start(); err != nil {
+//			t.Fatal(err)
+//		}
+//		r.Run(10)
+//		r.Finish()
+//		r.AssertTaskRan("Order", 5)
+//		r.AssertNoFailures()
+//	}
+type Runner struct {
+	t testing.TB
+	// Lead 执行任务使用的 Lead，可以在 Start 前替换，以使用 Lead 的中间件、TaskTimeout 等设置
+	Lead *navigator.Lead
+	// Line 被测试的虚拟用户
+	Line navigator.ILine
+	// Recorder 记录虚拟用户的请求数据
+	Recorder *Recorder
+	// Ctx 执行任务使用的 ctx
+	Ctx context.Context
+	// Fixture 注入虚拟用户的测试数据，代替 Lead.OnTestStart 返回的测试数据，可以在 Start 前设置
+	Fixture interface{}
+
+	results     []TaskResult
+	interrupted bool
+}
+
+// NewRunner 创建 Runner，同时创建 Recorder 记录请求数据
+func NewRunner(t testing.TB, line navigator.ILine) *Runner {
+	return &Runner{
+		t:        t,
+		Lead:     navigator.New(),
+		Line:     line,
+		Recorder: NewRecorder(t),
+		Ctx:      context.Background(),
+	}
+}
+
+// Start 设置共享数据与测试数据，执行 Init 与 OnStart
+func (r *Runner) Start() error {
+	if setter, ok := r.Line.(navigator.StoreSetter); ok {
+		setter.SetStore(r.Lead.Store())
+	}
+	if setter, ok := r.Line.(navigator.FixtureSetter); ok && r.Fixture != nil {
+		setter.SetFixture(r.Fixture)
+	}
+	r.Line.Init()
+	return r.Line.OnStart()
+}
+
+// Step 选择并执行下一个任务，虚拟用户已中断或没有任务时返回 nil
+func (r *Runner) Step() *TaskResult {
+	if r.interrupted {
+		return nil
+	}
+	task := r.Line.Next()
+	if task == nil {
+		r.interrupted = true
+		return nil
+	}
+
+	r.results = append(r.results, TaskResult{
+		Task: task,
+		Err:  runtask.RunTask(r.Ctx, r.Lead, r.Line, task),
+	})
+
+	if line, ok := r.Line.(navigator.StatusLine); ok {
+		switch line.Status() {
+		case navigator.StatusInterrupt:
+			r.interrupted = true
+		case navigator.StatusSkip:
+			line.ChangeStatus(navigator.StatusNormal)
+		}
+	}
+	return &r.results[len(r.results)-1]
+}
+
+// Run 最多执行 n 个任务，虚拟用户中断时提前结束，返回执行的任务数
+func (r *Runner) Run(n int) int {
+	for i := 0; i < n; i++ {
+		if r.Step() == nil {
+			return i
+		}
+	}
+	return n
+}
+
+// Finish 执行 OnFinish 并归还虚拟用户持有的资源
+func (r *Runner) Finish() {
+	defer navigator.ReleaseHeld(r.Line)
+	r.Line.OnFinish()
+}
+
+// Interrupted 虚拟用户是否已中断
+func (r *Runner) Interrupted() bool {
+	return r.interrupted
+}
+
+// Results 所有任务的执行结果，按执行顺序
+func (r *Runner) Results() []TaskResult {
+	return append([]TaskResult{}, r.results...)
+}
+
+// Count 名称为 name 的任务的执行次数，name 可以为任务的完整名称或方法名，见 MatchTask
+func (r *Runner) Count(name string) int {
+	n := 0
+	for _, result := range r.results {
+		if MatchTask(result.Task, name) {
+			n++
+		}
+	}
+	return n
+}
+
+// MatchTask 任务名称是否为 name，name 可以为任务的完整名称，
+// 也可以为方法名，例如 Order 或 (*MyTask).Order 匹配 github.com/xx/gotest.(*MyTask).Order-fm
+func MatchTask(task *navigator.Task, name string) bool {
+	if task.Name == name {
+		return true
+	}
+	taskName := strings.TrimSuffix(task.Name, "-fm")
+	return taskName == name || strings.HasSuffix(taskName, "."+name)
+}
+
+// AssertTaskRan 断言名称为 name 的任务执行了 n 次
+func (r *Runner) AssertTaskRan(name string, n int) {
+	r.t.Helper()
+	if got := r.Count(name); got != n {
+		r.t.Errorf("task %s ran %d times, want %d", name, got, n)
+	}
+}
+
+// AssertNoFailures 断言没有任务失败，也没有记录失败数据
+func (r *Runner) AssertNoFailures() {
+	r.t.Helper()
+	for _, result := range r.results {
+		if result.Err != nil {
+			r.t.Errorf("task %s failed: %v", result.Task.Name, result.Err)
+		}
+	}
+	r.Recorder.AssertNoFailures(r.t)
+}
@@ -0,0 +1,163 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:07
+ */
+package navigatortest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Hellowlonewolf/navigator"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"runtime"
+	"testing"
+)
+
+// fakeTB 记录断言的失败信息，不使测试失败
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+type orderLine struct {
+	*navigator.Line
+	started  bool
+	finished bool
+}
+
+func newOrderLine() *orderLine {
+	l := &orderLine{Line: navigator.NewLine()}
+	l.AddSetupFunc(l.Login)
+	l.AddWeightFunc(l.Browse, 1)
+	l.AddWeightFunc(l.Order, 1)
+	l.AddTeardownFunc(l.Logout)
+	l.SetSequential(true)
+	l.SetIterations(2)
+	return l
+}
+
+func (l *orderLine) OnStart() error {
+	l.started = true
+	return nil
+}
+
+func (l *orderLine) OnFinish() {
+	l.finished = true
+}
+
+func (l *orderLine) Login() {
+	leadutil.RecordSuccess("http", "/login", 10, 100)
+}
+
+func (l *orderLine) Browse() {
+	leadutil.RecordSuccess("http", "/items", 5, 1000)
+}
+
+func (l *orderLine) Order() {
+	l.Store().Incr("orders", 1)
+	leadutil.RecordSuccess("http", "/order", 20, 10)
+}
+
+func (l *orderLine) Logout() {}
+
+func TestRunner(t *testing.T) {
+	line := newOrderLine()
+	r := NewRunner(t, line)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Run(100); n != 6 {
+		t.Errorf("Run() = %d, want 6", n)
+	}
+	r.Finish()
+
+	if !line.started || !line.finished {
+		t.Error("OnStart and OnFinish should be called")
+	}
+	if !r.Interrupted() {
+		t.Error("user should be interrupted after teardown")
+	}
+	r.AssertTaskRan("Login", 1)
+	r.AssertTaskRan("Browse", 2)
+	r.AssertTaskRan("(*orderLine).Order", 2)
+	r.AssertTaskRan("Logout", 1)
+	r.AssertNoFailures()
+	r.Recorder.AssertRecorded(t, "/order", 2)
+
+	if n := r.Lead.Store().Incr("orders", 0); n != 2 {
+		t.Errorf("orders = %d, want 2", n)
+	}
+	if samples := r.Recorder.Samples(); len(samples) != 5 || samples[0].Name != "/login" {
+		t.Errorf("Samples() = %v", samples)
+	}
+}
+
+func TestRunnerFailures(t *testing.T) {
+	line := navigator.NewLine()
+	line.AddWeightFunc(func() {
+		panic("boom")
+	}, 1)
+	line.AddWeightFunc(func() {
+		line.Fail(errors.New("bad"))
+		leadutil.RecordFailure("http", "/bad", 1, "500")
+	}, 1)
+	line.SetSequential(true)
+
+	r := NewRunner(t, line)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	r.Run(2)
+
+	results := r.Results()
+	if len(results) != 2 || results[0].Err == nil || results[1].Err == nil {
+		t.Fatalf("Results() = %v", results)
+	}
+	if failures := r.Recorder.Failures(); len(failures) != 1 || failures[0].Err != "500" {
+		t.Errorf("Failures() = %v", failures)
+	}
+
+	// AssertNoFailures 应报告任务与请求的失败
+	fake := &fakeTB{TB: t}
+	r.t = fake
+	r.AssertNoFailures()
+	if len(fake.errors) != 3 {
+		t.Errorf("AssertNoFailures() reported %q, want the task and the request failures", fake.errors)
+	}
+}
+
+type tenant struct {
+	ID string
+}
+
+func TestRunnerFixture(t *testing.T) {
+	line := navigator.NewLine()
+	var got string
+	line.AddWeightFunc(func() {
+		if tenant, ok := navigator.FixtureOf[*tenant](line); ok {
+			got = tenant.ID
+		}
+	}, 1)
+
+	r := NewRunner(t, line)
+	r.Fixture = &tenant{ID: "t1"}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	r.Run(1)
+	if got != "t1" {
+		t.Errorf("fixture = %q, want t1", got)
+	}
+	if _, ok := navigator.FixtureOf[string](line); ok {
+		t.Error("FixtureOf[string] should return false")
+	}
+}
@@ -0,0 +1,66 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigator
+
+import (
+	"errors"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"time"
+)
+
+// OnStartRequestType OnStart 失败时记录失败数据使用的请求类型，名称为虚拟用户类名
+const OnStartRequestType = "on_start"
+
+// OnStartPolicy 虚拟用户 OnStart 失败时的处理策略，见 OnStartFailure。
+// 零值为不重试，等待 RetryInCriticalInterval 后创建新的虚拟用户代替，不结束压测。
+type OnStartPolicy struct {
+	// Retries 同一个虚拟用户重试 OnStart 的次数，重试仍失败时创建新的虚拟用户代替
+	Retries int
+	// Backoff 第一次重试前的等待时间，之后每次重试翻倍
+	Backoff time.Duration
+	// MaxBackoff 重试等待时间的上限，为0时不限制
+	MaxBackoff time.Duration
+	// MaxFailures 重试后仍失败的虚拟用户数达到该值时结束压测，分布式模式下向 master 发送 quit，为0时不限制
+	MaxFailures int64
+}
+
+// nextBackoff 获取下一次重试的等待时间
+func (p *OnStartPolicy) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// startUser 执行虚拟用户的 OnStart，每次失败都记录为 OnStartRequestType 类型的失败数据并调用 OnError，
+// 按 OnStartPolicy 重试，重试等待中 stopping 关闭时不再重试，返回最后一次的错误。
+// 数据源的数据已取完（leadutil.ErrFeederStop）不算失败，直接返回。
+func (l *Lead) startUser(stopping <-chan struct{}, name string, user Liner) error {
+	policy := l.option.onStartPolicy
+	backoff := policy.Backoff
+	for retries := 0; ; retries++ {
+		start := time.Now()
+		err := user.OnStart()
+		if err == nil || errors.Is(err, leadutil.ErrFeederStop) {
+			return err
+		}
+		leadutil.RecordFailure(OnStartRequestType, name, time.Since(start).Milliseconds(), err.Error())
+		user.OnError("OnStartError", err)
+		if retries >= policy.Retries {
+			return err
+		}
+
+		timer := leadutil.GetTimer(backoff)
+		select {
+		case <-timer.C:
+			leadutil.PutTimer(timer)
+		case <-stopping:
+			leadutil.PutTimer(timer)
+			return err
+		}
+		backoff = policy.nextBackoff(backoff)
+	}
+}
@@ -0,0 +1,190 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigator
+
+import (
+	"context"
+	"errors"
+	"github.com/Hellowlonewolf/navigator/leadutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startLine OnStart 前 failures 次失败的虚拟用户
+type startLine struct {
+	*Line
+	failures int
+	err      error
+	starts   int
+	errors   int
+}
+
+func (l *startLine) OnStart() error {
+	l.starts++
+	if l.starts <= l.failures {
+		return l.err
+	}
+	return nil
+}
+
+func (l *startLine) OnError(operationName string, err error) {
+	l.errors++
+}
+
+func TestOnStartPolicyNextBackoff(t *testing.T) {
+	tests := []struct {
+		policy  OnStartPolicy
+		backoff time.Duration
+		want    time.Duration
+	}{
+		{policy: OnStartPolicy{}, backoff: time.Second, want: 2 * time.Second},
+		{policy: OnStartPolicy{MaxBackoff: 3 * time.Second}, backoff: time.Second, want: 2 * time.Second},
+		{policy: OnStartPolicy{MaxBackoff: 3 * time.Second}, backoff: 2 * time.Second, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.nextBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextBackoff(%v) with %+v = %v, want %v", tt.backoff, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestStartUser(t *testing.T) {
+	errLogin := errors.New("login failed")
+	tests := []struct {
+		name     string
+		policy   OnStartPolicy
+		failures int
+		err      error
+		wantErr  error
+		starts   int
+		records  int
+		// minElapsed 重试等待的总时间下限
+		minElapsed time.Duration
+	}{
+		{name: "success", failures: 0, starts: 1},
+		{name: "no retry by default", failures: 1, err: errLogin, wantErr: errLogin, starts: 1, records: 1},
+		{name: "success after retries", policy: OnStartPolicy{Retries: 3, Backoff: 10 * time.Millisecond}, failures: 2, err: errLogin, starts: 3, records: 2, minElapsed: 30 * time.Millisecond},
+		{name: "retries exhausted", policy: OnStartPolicy{Retries: 2, Backoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond}, failures: 5, err: errLogin, wantErr: errLogin, starts: 3, records: 3, minElapsed: 25 * time.Millisecond},
+		{name: "feeder stopped", policy: OnStartPolicy{Retries: 3}, failures: 1, err: leadutil.ErrFeederStop, wantErr: leadutil.ErrFeederStop, starts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRecorder(t)
+			l := New(OnStartFailure(tt.policy))
+			user := &startLine{Line: NewLine(), failures: tt.failures, err: tt.err}
+
+			start := time.Now()
+			err := l.startUser(make(chan struct{}), "Buyer", user)
+			elapsed := time.Since(start)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("startUser() = %v, want %v", err, tt.wantErr)
+			}
+			if user.starts != tt.starts {
+				t.Fatalf("OnStart called %d times, want %d", user.starts, tt.starts)
+			}
+			if user.errors != tt.records {
+				t.Fatalf("OnError called %d times, want %d", user.errors, tt.records)
+			}
+			records := r.get()
+			if len(records) != tt.records {
+				t.Fatalf("%d failures recorded, want %d", len(records), tt.records)
+			}
+			for _, rec := range records {
+				if rec.requestType != OnStartRequestType || rec.name != "Buyer" || rec.failure != tt.err.Error() {
+					t.Fatalf("unexpected record %+v", rec)
+				}
+			}
+			if elapsed < tt.minElapsed {
+				t.Fatalf("retries take %v, want at least %v", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestStartUserStopping(t *testing.T) {
+	newRecorder(t)
+	l := New(OnStartFailure(OnStartPolicy{Retries: 10, Backoff: time.Hour}))
+	user := &startLine{Line: NewLine(), failures: 100, err: errors.New("login failed")}
+
+	stopping := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() { close(stopping) })
+	done := make(chan error)
+	go func() {
+		done <- l.startUser(stopping, "Buyer", user)
+	}()
+	select {
+	case err := <-done:
+		if err == nil || user.starts != 1 {
+			t.Fatalf("startUser() = %v after %d starts", err, user.starts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("startUser does not return when the user is stopping")
+	}
+}
+
+func TestOnStartFailureRespawn(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OnStartPolicy
+		failures int64
+		ended    bool
+	}{
+		{name: "failed user is replaced by a new one", failures: 2},
+		{name: "test ends after max failures", policy: OnStartPolicy{MaxFailures: 3}, failures: 100, ended: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created, finished int64
+			l := New(Interval("10ms"), RetryInCriticalInterval("10ms"), OnStartFailure(tt.policy))
+			l.ResetLine(func() ILine {
+				n := atomic.AddInt64(&created, 1)
+				line := &pingLine{Line: NewLine(), finished: &finished}
+				line.AddWeightFunc(line.Ping, 1)
+				if n <= tt.failures {
+					return &startLine{Line: line.Line, failures: 1, err: errors.New("login failed")}
+				}
+				return line
+			})
+			if err := l.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				l.Stop()
+				l.Wait()
+			}()
+			if err := l.Scale(1, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				l.Wait()
+				close(done)
+			}()
+			if tt.ended {
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("test is not ended after max failures")
+				}
+				if n := atomic.LoadInt64(&created); n < tt.policy.MaxFailures+1 {
+					t.Fatalf("%d users created, want at least %d", n, tt.policy.MaxFailures+1)
+				}
+				return
+			}
+
+			// 失败的虚拟用户执行 OnFinish 后由新的虚拟用户代替，压测不结束
+			waitFor(t, "a started user", func() bool {
+				return atomic.LoadInt64(&created) == tt.failures+1 && l.ActiveUsers() == 1
+			})
+			select {
+			case <-done:
+				t.Fatal("test is ended without max failures")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
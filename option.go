@@ -18,9 +18,46 @@ type option struct {
 	// |--- task running time ---|--- dynamic interval time ---|
 	enableDynamicInterval bool
 
+	// waitTime 等待时间策略，设置后 interval 与 enableDynamicInterval 不再生效
+	waitTime WaitTimeFunc
+
 	// taskCycle 任务执行周期
 	taskCycle int64
 
+	// taskTimeout 支持 context 的任务的默认超时时间，为0时不超时
+	taskTimeout time.Duration
+
+	// stopTimeout 停止时等待虚拟用户执行完当前任务的时间，超时后取消任务的 ctx，为0时立即取消
+	stopTimeout time.Duration
+
+	// duration 压测运行时间，为0时使用 --run-time 参数
+	duration time.Duration
+	// sharedIterations 所有虚拟用户共享的任务次数，为0时使用 --shared-iterations 参数
+	sharedIterations int64
+
+	// loadShape 单机模式的负载曲线
+	loadShape boomer.LoadShape
+
+	// arrivalRate 开放模型设置，为 nil 时使用闭合模型
+	arrivalRate *arrivalRate
+
+	// enableTaskStats 记录每个任务的执行时间
+	enableTaskStats bool
+
+	// tags 仅执行带有其中任一标签的任务，为 nil 时使用 --tags 参数
+	tags []string
+	// excludeTags 不执行带有其中任一标签的任务，为 nil 时使用 --exclude-tags 参数
+	excludeTags []string
+
+	// onStartPolicy 虚拟用户 OnStart 失败时的处理策略
+	onStartPolicy OnStartPolicy
+
+	// thresholds 压测的阈值
+	thresholds []*boomer.Threshold
+
+	// debugIterations 调试模式下每个虚拟用户执行的任务次数，为0时使用 --debug_iterations 参数
+	debugIterations int
+
 	boomerClient *boomer.Boomer
 
 	// retryInCriticalInterval 虚拟用户执行出错时，重试的等待时间，默认2s
@@ -73,6 +110,15 @@ func EnableDynamicInterval() Option {
 	}
 }
 
+// WaitTime 设置虚拟用户执行任务后的等待时间策略，设置后 Interval 与 EnableDynamicInterval 不再生效。
+// 虚拟用户实现了 WaitTimer 接口时，优先使用虚拟用户自己的等待时间策略。
+// 示例：WaitTime(Between(time.Second, 3*time.Second))
+func WaitTime(waitTime WaitTimeFunc) Option {
+	return func(opt *option) {
+		opt.waitTime = waitTime
+	}
+}
+
 // TaskCycle 设置任务执行周期次数，每次执行 Task 函数则计数一次，达到次数后停止执行 task 。
 // onstart不计算
 func TaskCycle(times int) Option {
@@ -81,6 +127,136 @@ func TaskCycle(times int) Option {
 	}
 }
 
+// TaskTimeout 支持 context 的任务（AddWeightFuncCtx 添加）的默认超时时间，超时后取消任务的 ctx，
+// 任务自己设置了 Timeout 时以任务的为准。
+// 参数格式为语义化时间，示例：1ms。其他示例：1s,1min
+func TaskTimeout(timeout string) Option {
+	t, err := time.ParseDuration(timeout)
+	if err != nil {
+		t = 0
+	}
+
+	return func(opt *option) {
+		opt.taskTimeout = t
+	}
+}
+
+// StopTimeout 设置停止（包括缩容）时等待虚拟用户执行完当前任务的时间，类似 locust 的 stop_timeout。
+// 虚拟用户执行完当前任务后退出并执行 OnFinish，超时未退出的虚拟用户的任务 ctx 被取消，数量记录在统计数据中。
+// 未设置时立即取消，分布式模式下 master 设置了 stop_timeout 时以 master 的为准。
+// 参数格式为语义化时间，示例：1ms。其他示例：1s,1min
+func StopTimeout(timeout string) Option {
+	t, err := time.ParseDuration(timeout)
+	if err != nil {
+		t = 0
+	}
+
+	return func(opt *option) {
+		opt.stopTimeout = t
+	}
+}
+
+// Duration 设置压测运行时间，从第一次启动虚拟用户时开始计算，到达后结束压测，同 locust 的 --run-time。
+// 结束时按 StopTimeout 等待虚拟用户执行完当前任务，分布式模式下向 master 发送 quit。
+// 设置后 --run-time 参数不再生效。
+// 参数格式为语义化时间，示例：30s。其他示例：10m,1h30m
+func Duration(duration string) Option {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		d = 0
+	}
+
+	return func(opt *option) {
+		opt.duration = d
+	}
+}
+
+// SharedIterations 设置所有虚拟用户共享的任务次数，每个虚拟用户执行任务前获取一次，
+// 次数用完后结束压测，分布式模式下向 master 发送 quit，次数仅在当前 worker 内共享。
+// 与 TaskCycle 不同，TaskCycle 限制的是每个虚拟用户的任务次数。
+// 设置后 --shared-iterations 参数不再生效。
+func SharedIterations(n int) Option {
+	return func(opt *option) {
+		opt.sharedIterations = int64(n)
+	}
+}
+
+// LoadShape 设置负载曲线，按时间控制虚拟用户数与每秒启动的用户数，同 locust 的 LoadTestShape，负载曲线结束时压测结束。
+// 负载曲线以单机模式运行，Run 时未通过 BoomerClient 设置 boomer 则创建单机模式的 boomer，无需 master。
+// 内置 boomer.StepShape、boomer.RampShape、boomer.SpikeShape、boomer.StagesShape，也可以使用 boomer.LoadShapeFunc 自定义。
+func LoadShape(shape boomer.LoadShape) Option {
+	return func(opt *option) {
+		opt.loadShape = shape
+	}
+}
+
+// ArrivalRate 使用开放模型，每秒启动 rate 次任务，与任务的响应时间无关，同 k6 的 constant-arrival-rate。
+// 启动时创建 preAllocatedUsers 个虚拟用户，每次启动的任务由一个空闲的虚拟用户执行，虚拟用户执行任务后不等待。
+// 没有空闲虚拟用户时创建新的虚拟用户，最多 maxUsers 个，达到上限时丢弃该任务，
+// 计入 ArrivalRateStats 的 DroppedIterations，不计为失败的请求，丢弃的任务数说明被测系统或虚拟用户数不足以支撑目标速率。
+// 开放模型以单机模式运行，运行中可通过 Lead.SetArrivalRate 调整速率，Lead.ArrivalRateStats 获取统计数据。
+func ArrivalRate(rate float64, preAllocatedUsers, maxUsers int) Option {
+	return func(opt *option) {
+		opt.arrivalRate = &arrivalRate{
+			rate:              rate,
+			preAllocatedUsers: preAllocatedUsers,
+			maxUsers:          maxUsers,
+		}
+	}
+}
+
+// EnableTaskStats 记录每个任务的执行时间，请求类型为 "task"，名称为任务函数名，
+// 任务 panic 或调用 Line.Fail 时记录为失败，用于统计业务事务的耗时。
+func EnableTaskStats() Option {
+	return func(opt *option) {
+		opt.enableTaskStats = true
+	}
+}
+
+// Tags 仅执行带有其中任一标签的任务，任务标签通过 Task.Tag 添加，同 locust 的 --tags。
+// 设置后 --tags 参数不再生效。
+func Tags(tags ...string) Option {
+	return func(opt *option) {
+		opt.tags = append([]string{}, tags...)
+	}
+}
+
+// ExcludeTags 不执行带有其中任一标签的任务，同 locust 的 --exclude-tags。
+// 设置后 --exclude-tags 参数不再生效。
+func ExcludeTags(tags ...string) Option {
+	return func(opt *option) {
+		opt.excludeTags = append([]string{}, tags...)
+	}
+}
+
+// OnStartFailure 设置虚拟用户 OnStart 失败时的处理策略：按 Retries、Backoff 重试同一个虚拟用户，
+// 重试仍失败时等待 RetryInCriticalInterval 后创建新的虚拟用户代替，失败的虚拟用户数达到 MaxFailures 时结束压测。
+// 每次失败都会记录为请求类型 "on_start"、名称为虚拟用户类名的失败数据，在 master 的统计中可见。
+//
+//	navigator.OnStartFailure(navigator.OnStartPolicy{Retries: 3, Backoff: time.Second, MaxFailures: 100})
+func OnStartFailure(policy OnStartPolicy) Option {
+	return func(opt *option) {
+		opt.onStartPolicy = policy
+	}
+}
+
+// Thresholds 设置压测的阈值，例如总失败率低于 1%、"POST /order" 的 p95 低于 300ms、RPS 高于 1000，见 boomer.Threshold。
+// 运行中每秒检查一次，设置了 Abort 的阈值未通过时立即结束压测；压测结束时使用最后的统计数据检查所有阈值。
+// Run 结束时输出阈值检查结果，有阈值未通过时以状态码1退出，可以作为 CI 的门禁；Start 启动时通过 Lead.ThresholdResults 获取结果。
+// 分布式模式下每个 worker 使用自己的统计数据检查。
+func Thresholds(thresholds ...*boomer.Threshold) Option {
+	return func(opt *option) {
+		opt.thresholds = append([]*boomer.Threshold{}, thresholds...)
+	}
+}
+
+// DebugIterations 设置调试模式下每个虚拟用户执行的任务次数，设置后 --debug_iterations 参数不再生效，见 Lead.Debug
+func DebugIterations(n int) Option {
+	return func(opt *option) {
+		opt.debugIterations = n
+	}
+}
+
 // BoomerClient custom boomer
 func BoomerClient(boomerClient *boomer.Boomer) Option {
 	return func(opt *option) {
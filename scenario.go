@@ -0,0 +1,80 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"reflect"
+	"runtime"
+)
+
+// 虚拟用户场景阶段，依次执行 setup、主阶段、teardown
+const (
+	phaseSetup = iota
+	phaseMain
+	phaseTeardown
+	phaseDone
+)
+
+// AddSetupFunc 添加 setup 阶段任务，虚拟用户启动后按添加顺序各执行一次，随后进入主阶段。
+// setup 任务同 locust 的 on_start，不参与标签筛选
+func (l *Line) AddSetupFunc(fn func()) {
+	l.setupTasks = append(l.setupTasks, &Task{
+		Fn:   l.safeFn(fn),
+		Name: runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
+	})
+}
+
+// AddTeardownFunc 添加 teardown 阶段任务，主阶段执行完成后按添加顺序各执行一次，随后中断该虚拟用户。
+// 主阶段一直执行（未通过 SetIterations 设置执行次数）时，teardown 阶段不会执行。
+// teardown 任务同 locust 的 on_stop，不参与标签筛选。
+func (l *Line) AddTeardownFunc(fn func()) {
+	l.teardownTasks = append(l.teardownTasks, &Task{
+		Fn:   l.safeFn(fn),
+		Name: runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
+	})
+}
+
+// SetSequential 设置主阶段按任务添加顺序执行，忽略任务权重，同 locust 的 SequentialTaskSet
+func (l *Line) SetSequential(sequential bool) {
+	l.sequential = sequential
+}
+
+// SetIterations 设置主阶段执行次数，0 表示一直执行。
+// 顺序执行时，每按顺序执行完一遍所有任务计数一次；按权重执行时，每执行一个任务计数一次。
+func (l *Line) SetIterations(iterations int) {
+	l.iterations = iterations
+}
+
+// mainFinished 主阶段是否执行完成，顺序执行时需等待进入的任务集合执行完成
+func (l *Line) mainFinished() bool {
+	if l.sequential && len(l.taskSets) > 0 {
+		return false
+	}
+	return l.iterations > 0 && l.iteration >= l.iterations
+}
+
+// nextSequential 按添加顺序选择主阶段的下一个任务
+func (l *Line) nextSequential() *Task {
+	if l.n == 0 {
+		return nil
+	}
+	i := l.tasks[l.index]
+	l.index++
+	if l.index >= l.n {
+		l.index = 0
+		l.iteration++
+	}
+	return i
+}
+
+// NewSequentialTaskSet 创建按添加顺序执行任务的任务集合，同 locust 的 SequentialTaskSet。
+// iterations 为每次进入该任务集合后的执行遍数，执行完成后自动返回上一级，0 表示一直执行，
+// 直到调用 InterruptTaskSet 返回上一级。
+func (l *Line) NewSequentialTaskSet(name string, iterations int) *TaskSet {
+	taskSet := l.NewTaskSet(name)
+	taskSet.sequential = true
+	taskSet.iterations = iterations
+	return taskSet
+}
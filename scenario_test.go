@@ -0,0 +1,137 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// phaseLine 测试场景阶段的虚拟用户
+type phaseLine struct {
+	*Line
+}
+
+func (l *phaseLine) Login()   {}
+func (l *phaseLine) Prepare() {}
+func (l *phaseLine) A()       {}
+func (l *phaseLine) B()       {}
+func (l *phaseLine) X()       {}
+func (l *phaseLine) Y()       {}
+func (l *phaseLine) Logout()  {}
+
+// taskName 获取任务的方法名，如 (*phaseLine).A-fm 为 A，nil 为空字符串
+func taskName(task *Task) string {
+	if task == nil {
+		return ""
+	}
+	name := strings.TrimSuffix(task.Name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// nextNames 连续调用 n 次 Next，返回选中的任务名
+func nextNames(l *Line, n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		names = append(names, taskName(l.Next()))
+	}
+	return names
+}
+
+func TestLineNextPhases(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       func(l *phaseLine)
+		calls       int
+		want        []string
+		interrupted bool
+	}{
+		{
+			name: "setup, sequential main and teardown",
+			build: func(l *phaseLine) {
+				l.AddSetupFunc(l.Login)
+				l.AddSetupFunc(l.Prepare)
+				l.AddWeightFunc(l.A, 1)
+				l.AddWeightFunc(l.B, 5)
+				l.AddTeardownFunc(l.Logout)
+				l.SetSequential(true)
+				l.SetIterations(2)
+			},
+			calls:       8,
+			want:        []string{"Login", "Prepare", "A", "B", "A", "B", "Logout", ""},
+			interrupted: true,
+		},
+		{
+			name: "weighted main counts every task",
+			build: func(l *phaseLine) {
+				l.AddWeightFunc(l.A, 1)
+				l.AddTeardownFunc(l.Logout)
+				l.SetIterations(3)
+			},
+			calls:       5,
+			want:        []string{"A", "A", "A", "Logout", ""},
+			interrupted: true,
+		},
+		{
+			name: "sequential task set finishes before teardown",
+			build: func(l *phaseLine) {
+				ts := l.NewSequentialTaskSet("set", 1)
+				ts.AddWeightFunc(l.X, 1)
+				ts.AddWeightFunc(l.Y, 1)
+				l.AddWeightFunc(l.A, 1)
+				l.AddTaskSet(ts, 1)
+				l.AddTeardownFunc(l.Logout)
+				l.SetSequential(true)
+				l.SetIterations(1)
+			},
+			calls:       5,
+			want:        []string{"A", "X", "Y", "Logout", ""},
+			interrupted: true,
+		},
+		{
+			name: "main runs forever without iterations",
+			build: func(l *phaseLine) {
+				l.AddSetupFunc(l.Login)
+				l.AddWeightFunc(l.A, 1)
+				l.AddWeightFunc(l.B, 1)
+				l.AddTeardownFunc(l.Logout)
+				l.SetSequential(true)
+			},
+			calls: 7,
+			want:  []string{"Login", "A", "B", "A", "B", "A", "B"},
+		},
+		{
+			name: "no teardown",
+			build: func(l *phaseLine) {
+				l.AddWeightFunc(l.A, 1)
+				l.SetSequential(true)
+				l.SetIterations(1)
+			},
+			calls:       2,
+			want:        []string{"A", ""},
+			interrupted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &phaseLine{Line: NewLine()}
+			tt.build(l)
+			l.Init()
+			if got := nextNames(l.Line, tt.calls); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Next() = %q, want %q", got, tt.want)
+			}
+			if interrupted := l.Status() == StatusInterrupt; interrupted != tt.interrupted {
+				t.Fatalf("interrupted = %v, want %v", interrupted, tt.interrupted)
+			}
+
+			// Init 后重新从 setup 阶段开始
+			l.Init()
+			if got := nextNames(l.Line, tt.calls); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Next() after Init = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
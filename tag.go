@@ -0,0 +1,115 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"flag"
+	"strings"
+)
+
+var (
+	TagsFlag        = flag.String("tags", "", "only run the tasks with any of the tags, multiple tags are separated by comma, example: read,write")
+	ExcludeTagsFlag = flag.String("exclude-tags", "", "don't run the tasks with any of the tags, multiple tags are separated by comma, example: admin")
+)
+
+// Tag 为任务添加标签，用于通过 Tags、ExcludeTags 或 --tags、--exclude-tags 筛选执行的任务，
+// 任务集合的标签对集合内的所有任务生效，同 locust 的 @tag。setup、teardown 阶段的任务不参与筛选。
+// 示例：l.AddWeightFunc(l.Read, 1).Tag("read")
+// AddTaskSet 未添加任务集合返回 nil 时不做处理。
+func (t *Task) Tag(tags ...string) *Task {
+	if t == nil {
+		return nil
+	}
+	t.Tags = append(t.Tags, tags...)
+	return t
+}
+
+// tagFilter 按标签筛选任务
+type tagFilter struct {
+	// tags 不为空时，仅执行带有其中任一标签的任务
+	tags []string
+	// excludeTags 不执行带有其中任一标签的任务
+	excludeTags []string
+}
+
+// newTagFilter 创建标签筛选，优先使用 Tags、ExcludeTags 设置，未设置时使用命令行参数
+func newTagFilter(opt *option) *tagFilter {
+	f := &tagFilter{
+		tags:        opt.tags,
+		excludeTags: opt.excludeTags,
+	}
+	if f.tags == nil && flag.Parsed() {
+		f.tags = splitTags(*TagsFlag)
+	}
+	if f.excludeTags == nil && flag.Parsed() {
+		f.excludeTags = splitTags(*ExcludeTagsFlag)
+	}
+	return f
+}
+
+// splitTags 解析逗号分隔的标签
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (f *tagFilter) enabled() bool {
+	return f != nil && (len(f.tags) > 0 || len(f.excludeTags) > 0)
+}
+
+// apply 在虚拟用户 Init 前筛选任务，返回筛选后是否还有任务
+func (f *tagFilter) apply(line ILine) bool {
+	if !f.enabled() {
+		return true
+	}
+	tasks := f.filter(line.GetTask(), nil)
+	line.SetTask(tasks)
+	return len(tasks) > 0
+}
+
+// filter 筛选任务，inherited 为上级任务集合的标签，
+// 任务集合内的任务都被筛除时，该任务集合也被筛除
+func (f *tagFilter) filter(tasks []*Task, inherited []string) []*Task {
+	filtered := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		tags := append(append([]string{}, inherited...), task.Tags...)
+		if task.TaskSet != nil {
+			subTasks := f.filter(task.TaskSet.GetTask(), tags)
+			task.TaskSet.SetTask(subTasks)
+			if len(subTasks) > 0 {
+				filtered = append(filtered, task)
+			}
+			continue
+		}
+		if f.match(tags) {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered
+}
+
+// match 任务标签是否符合筛选条件
+func (f *tagFilter) match(tags []string) bool {
+	if hasAnyTag(tags, f.excludeTags) {
+		return false
+	}
+	return len(f.tags) == 0 || hasAnyTag(tags, f.tags)
+}
+
+func hasAnyTag(tags []string, targets []string) bool {
+	for _, tag := range tags {
+		for _, target := range targets {
+			if tag == target {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitTags(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{s: "", want: nil},
+		{s: "read", want: []string{"read"}},
+		{s: "read, write ,,admin", want: []string{"read", "write", "admin"}},
+	}
+	for _, tt := range tests {
+		if got := splitTags(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTags(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+// tagLine 测试标签筛选的虚拟用户，admin 任务集合带有 admin 标签
+type tagLine struct {
+	*Line
+}
+
+func (l *tagLine) Read()   {}
+func (l *tagLine) Write()  {}
+func (l *tagLine) Report() {}
+func (l *tagLine) Audit()  {}
+
+func newTagLine() ILine {
+	l := &tagLine{Line: NewLine()}
+	l.AddWeightFunc(l.Read, 1).Tag("read")
+	l.AddWeightFunc(l.Write, 1).Tag("write")
+	admin := l.NewTaskSet("admin")
+	admin.AddWeightFunc(l.Report, 1)
+	admin.AddWeightFunc(l.Audit, 1).Tag("audit")
+	l.AddTaskSet(admin, 1).Tag("admin")
+	return l
+}
+
+// taskNames 获取任务名，任务集合展开为集合内的任务
+func taskNames(tasks []*Task) []string {
+	var names []string
+	for _, task := range tasks {
+		if task.TaskSet != nil {
+			names = append(names, taskNames(task.TaskSet.GetTask())...)
+			continue
+		}
+		names = append(names, taskName(task))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTagFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		tags        []string
+		excludeTags []string
+		want        []string
+		kept        bool
+	}{
+		{name: "no tags", want: []string{"Audit", "Read", "Report", "Write"}, kept: true},
+		{name: "tags", tags: []string{"read", "write"}, want: []string{"Read", "Write"}, kept: true},
+		{name: "tags of task set are inherited", tags: []string{"admin"}, want: []string{"Audit", "Report"}, kept: true},
+		{name: "tags of task in task set", tags: []string{"audit"}, want: []string{"Audit"}, kept: true},
+		{name: "exclude tags", excludeTags: []string{"admin"}, want: []string{"Read", "Write"}, kept: true},
+		{name: "exclude tags of task in task set", excludeTags: []string{"audit", "write"}, want: []string{"Read", "Report"}, kept: true},
+		{name: "exclude tags first", tags: []string{"admin"}, excludeTags: []string{"audit"}, want: []string{"Report"}, kept: true},
+		{name: "all tasks filtered out", tags: []string{"none"}, want: nil, kept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &tagFilter{tags: tt.tags, excludeTags: tt.excludeTags}
+			line := newTagLine()
+			if kept := f.apply(line); kept != tt.kept {
+				t.Fatalf("apply() = %v, want %v", kept, tt.kept)
+			}
+			if got := taskNames(line.GetTask()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tasks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserClassesFilteredByTags(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "no tags", want: []string{"Reader", "Writer"}},
+		{name: "class without the tags is not created", opts: []Option{Tags("read")}, want: []string{"Reader"}},
+		{name: "class with all the tasks excluded is not created", opts: []Option{ExcludeTags("read")}, want: []string{"Writer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.opts...)
+			l.Register("Reader", func() ILine {
+				line := &tagLine{Line: NewLine()}
+				line.AddWeightFunc(line.Read, 1).Tag("read")
+				return line
+			})
+			l.Register("Writer", func() ILine {
+				line := &tagLine{Line: NewLine()}
+				line.AddWeightFunc(line.Write, 1).Tag("write")
+				return line
+			})
+
+			var names []string
+			for _, task := range l.userClassTasks() {
+				names = append(names, task.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("user classes = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagFilterKeepsSetupAndTeardown(t *testing.T) {
+	line := &tagLine{Line: NewLine()}
+	line.AddSetupFunc(line.Report)
+	line.AddWeightFunc(line.Read, 1).Tag("read")
+	line.AddWeightFunc(line.Write, 1).Tag("write")
+	line.AddTeardownFunc(line.Audit)
+	line.SetSequential(true)
+	line.SetIterations(1)
+
+	f := &tagFilter{tags: []string{"read"}, excludeTags: []string{"write"}}
+	if !f.apply(line) {
+		t.Fatal("apply() = false, want the read task kept")
+	}
+	line.Init()
+	var names []string
+	for task := line.Next(); task != nil && len(names) < 10; task = line.Next() {
+		names = append(names, taskName(task))
+	}
+	// setup、teardown 任务同 locust 的 on_start、on_stop，不参与标签筛选
+	if want := []string{"Report", "Read", "Audit"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("tasks = %q, want %q", names, want)
+	}
+}
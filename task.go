@@ -4,20 +4,84 @@
  */
 package navigator
 
+import (
+	"context"
+	"time"
+)
+
 // Task 任务结构
 type Task struct {
 	// The weight is used to distribute goroutines over multiple tasks.
 	Weight int
 	// 1-9999  Execution from small to large
+	// 有 Order 的任务仅在按权重执行前各执行一次，明确的执行阶段请使用 Line.AddSetupFunc、Line.SetSequential 等
 	Order int
 	// Fn is called by the goroutines allocated to this task, in a loop.
-	Fn   func()
-	Name string
+	Fn func()
+	// FnCtx 支持 context 的任务函数，设置后优先于 Fn 执行，
+	// 虚拟用户停止、缩容或任务超时时，ctx 被取消
+	FnCtx func(ctx context.Context)
+	// Timeout 任务超时时间，仅对 FnCtx 生效，为0时使用 TaskTimeout 的设置
+	Timeout time.Duration
+	Name    string
+	// TaskSet 不为空时，该任务为子任务集合，选中后进入该任务集合执行
+	TaskSet *TaskSet
+	// Tags 任务标签，见 Tag
+	Tags []string
 
 	SmoothWeight
 }
 
+// run 执行任务，FnCtx 不为空时使用 ctx 执行 FnCtx，
+// timeout 为任务未设置超时时间时的默认超时时间，为0时不超时
+func (t *Task) run(ctx context.Context, timeout time.Duration) {
+	if t.FnCtx == nil {
+		t.Fn()
+		return
+	}
+
+	if t.Timeout > 0 {
+		timeout = t.Timeout
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	t.FnCtx(ctx)
+}
+
 type SmoothWeight struct {
 	CurrentWeight   int
 	EffectiveWeight int
 }
+
+// smoothWeighted 平滑加权轮询，遍历所有任务权重,执行当前权重最高的任务,
+// 执行后该任务当前权重会被减去所有任务权重,以此计算任务执行概率
+func smoothWeighted(tasks []*Task) (best *Task) {
+	total := 0
+	for _, w := range tasks {
+		if w == nil {
+			continue
+		}
+		w.CurrentWeight += w.EffectiveWeight
+		total += w.EffectiveWeight
+		if w.EffectiveWeight < w.Weight {
+			w.EffectiveWeight++
+		}
+
+		if best == nil || w.CurrentWeight > best.CurrentWeight {
+			best = w
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	// 修改原数据的当前任务权重,并返回执行该任务
+	best.CurrentWeight -= total
+	return best
+}
@@ -0,0 +1,150 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+)
+
+// TaskSet 任务集合，参考 locust 的 TaskSet，通过 Line.NewTaskSet 创建。
+// 任务集合内可以添加任务，也可以添加子任务集合，虚拟用户进入任务集合后按权重执行集合内的任务，
+// 在任务中调用 Line.InterruptTaskSet 返回上一级。
+type TaskSet struct {
+	Name  string
+	tasks []*Task
+	line  *Line
+
+	// 顺序任务集合，见 Line.NewSequentialTaskSet
+	sequential bool
+	iterations int
+	iteration  int
+	index      int
+}
+
+// AddWeightFunc 添加任务函数，并设置权重，返回添加的任务
+func (ts *TaskSet) AddWeightFunc(fn func(), weight int) *Task {
+	task := &Task{
+		Weight: weight,
+		Fn:     ts.line.safeFn(fn),
+		Name:   runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
+	}
+	ts.AddTask(task)
+	return task
+}
+
+// AddWeightFuncCtx 添加支持 context 的任务函数，并设置权重，返回添加的任务
+func (ts *TaskSet) AddWeightFuncCtx(fn func(ctx context.Context), weight int) *Task {
+	safeFnCtx := ts.line.safeFnCtx(fn)
+	task := &Task{
+		Weight: weight,
+		Fn: func() {
+			safeFnCtx(context.Background())
+		},
+		FnCtx: safeFnCtx,
+		Name:  runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(),
+	}
+	ts.AddTask(task)
+	return task
+}
+
+// AddTaskSet 添加子任务集合，并设置权重，返回添加的任务。
+// 子任务集合需先添加任务，不能为空，也不能包含 ts（包括 ts 自身及 A→B→A 的相互嵌套），否则不添加并返回 nil
+func (ts *TaskSet) AddTaskSet(taskSet *TaskSet, weight int) *Task {
+	if taskSet == nil || len(taskSet.tasks) == 0 || taskSet.contains(ts, map[*TaskSet]bool{}) {
+		return nil
+	}
+	task := &Task{
+		Weight:  weight,
+		Name:    taskSet.Name,
+		TaskSet: taskSet,
+	}
+	ts.AddTask(task)
+	return task
+}
+
+// AddTask 添加任务
+func (ts *TaskSet) AddTask(task ...*Task) {
+	ts.tasks = append(ts.tasks, task...)
+}
+
+// GetTask 获取任务集合内的任务
+func (ts *TaskSet) GetTask() []*Task {
+	return ts.tasks
+}
+
+// SetTask 设置任务集合内的任务
+func (ts *TaskSet) SetTask(tasks []*Task) {
+	ts.tasks = tasks
+}
+
+// contains ts 是否为 target 或嵌套包含 target，visited 为已检查的任务集合
+func (ts *TaskSet) contains(target *TaskSet, visited map[*TaskSet]bool) bool {
+	if ts == target {
+		return true
+	}
+	if visited[ts] {
+		return false
+	}
+	visited[ts] = true
+	for _, t := range ts.tasks {
+		if t.TaskSet != nil && t.TaskSet.contains(target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// init 初始化任务权重，包括子任务集合，visited 为已初始化的任务集合，
+// 每个任务集合只初始化一次，通过 AddTask 直接添加形成的循环嵌套也不会无限递归
+func (ts *TaskSet) init(visited map[*TaskSet]bool) {
+	if visited[ts] {
+		return
+	}
+	visited[ts] = true
+	for _, t := range ts.tasks {
+		t.CurrentWeight = 0
+		t.EffectiveWeight = t.Weight
+		if t.TaskSet != nil {
+			t.TaskSet.init(visited)
+		}
+	}
+}
+
+// reset 进入任务集合时重置顺序执行进度
+func (ts *TaskSet) reset() {
+	ts.index = 0
+	ts.iteration = 0
+}
+
+// finished 顺序任务集合是否执行完成
+func (ts *TaskSet) finished() bool {
+	return ts.sequential && ts.iterations > 0 && ts.iteration >= ts.iterations
+}
+
+// next 选择下一个任务，顺序任务集合按添加顺序选择，其他按权重选择
+func (ts *TaskSet) next() *Task {
+	if ts.sequential {
+		if len(ts.tasks) == 0 || ts.finished() {
+			return nil
+		}
+		i := ts.tasks[ts.index]
+		ts.index++
+		if ts.index >= len(ts.tasks) {
+			ts.index = 0
+			ts.iteration++
+		}
+		return i
+	}
+
+	switch len(ts.tasks) {
+	case 0:
+		return nil
+	case 1:
+		return ts.tasks[0]
+	}
+	return smoothWeighted(ts.tasks)
+}
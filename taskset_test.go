@@ -0,0 +1,143 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"testing"
+)
+
+func noop() {}
+
+func TestTaskSetWeighted(t *testing.T) {
+	l := NewLine()
+	ts := l.NewTaskSet("browse")
+	view := ts.AddWeightFunc(noop, 3)
+	leave := ts.AddWeightFunc(noop, 1)
+	ts.init(map[*TaskSet]bool{})
+
+	counts := map[*Task]int{}
+	for i := 0; i < 400; i++ {
+		counts[ts.next()]++
+	}
+	if counts[view] != 300 || counts[leave] != 100 {
+		t.Fatalf("view %d times, leave %d times, want 300 and 100", counts[view], counts[leave])
+	}
+}
+
+func TestTaskSetAddTaskSet(t *testing.T) {
+	l := NewLine()
+	newSet := func(name string) *TaskSet {
+		ts := l.NewTaskSet(name)
+		ts.AddWeightFunc(noop, 1)
+		return ts
+	}
+	a, b, c := newSet("a"), newSet("b"), newSet("c")
+	if a.AddTaskSet(b, 1) == nil || b.AddTaskSet(c, 1) == nil {
+		t.Fatal("failed to add a nested task set")
+	}
+
+	tests := []struct {
+		name   string
+		parent *TaskSet
+		child  *TaskSet
+		added  bool
+	}{
+		{name: "self", parent: a, child: a},
+		{name: "mutual nesting", parent: b, child: a},
+		{name: "indirect nesting", parent: c, child: a},
+		{name: "empty", parent: a, child: l.NewTaskSet("empty")},
+		{name: "nil", parent: a, child: nil},
+		{name: "same child twice", parent: a, child: c, added: true},
+		{name: "sibling", parent: c, child: newSet("d"), added: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := len(tt.parent.GetTask())
+			task := tt.parent.AddTaskSet(tt.child, 1)
+			if added := task != nil; added != tt.added {
+				t.Fatalf("added = %v, want %v", added, tt.added)
+			}
+			if !tt.added && len(tt.parent.GetTask()) != n {
+				t.Fatal("rejected task set is added")
+			}
+		})
+	}
+
+	if l.AddTaskSet(l.NewTaskSet("empty"), 1) != nil || l.AddTaskSet(nil, 1) != nil {
+		t.Fatal("an empty task set is added to the line")
+	}
+	// 未添加时返回 nil，Tag 不做处理
+	if l.AddTaskSet(l.NewTaskSet("empty"), 1).Tag("admin") != nil {
+		t.Fatal("Tag of a nil task should return nil")
+	}
+}
+
+func TestTaskSetInitCycle(t *testing.T) {
+	l := NewLine()
+	a := l.NewTaskSet("a")
+	b := l.NewTaskSet("b")
+	a.AddWeightFunc(noop, 1)
+	b.AddWeightFunc(noop, 1)
+	a.AddTaskSet(b, 1)
+	// 绕过 AddTaskSet 的检查直接添加，形成循环嵌套
+	b.AddTask(&Task{Name: "a", Weight: 1, TaskSet: a})
+	l.AddTaskSet(a, 1)
+
+	l.Init()
+	for _, task := range b.GetTask() {
+		if task.EffectiveWeight != task.Weight {
+			t.Fatalf("task %s is not initialized", task.Name)
+		}
+	}
+}
+
+func TestTaskSetNestingAndInterrupt(t *testing.T) {
+	l := NewLine()
+	l.SetSequential(true)
+	inner := l.NewTaskSet("inner")
+	zoom := inner.AddWeightFunc(noop, 1)
+	outer := l.NewTaskSet("outer")
+	outer.AddTaskSet(inner, 1)
+	browse := outer.AddWeightFunc(noop, 1)
+	home := l.AddWeightFunc(noop, 1)
+	l.AddTaskSet(outer, 1)
+	l.Init()
+
+	steps := []struct {
+		interrupt bool
+		task      *Task
+		current   *TaskSet
+	}{
+		{task: home},
+		{task: zoom, current: inner},
+		{task: zoom, current: inner},
+		// 返回上一级任务集合
+		{interrupt: true, task: browse, current: outer},
+		{task: zoom, current: inner},
+		{interrupt: true, task: browse, current: outer},
+		// 返回虚拟用户的主阶段
+		{interrupt: true, task: home},
+	}
+	for i, step := range steps {
+		if step.interrupt {
+			l.InterruptTaskSet()
+		}
+		if task := l.Next(); task != step.task {
+			t.Fatalf("step %d: Next() = %v, want %v", i, task, step.task)
+		}
+		if current := l.CurrentTaskSet(); current != step.current {
+			t.Fatalf("step %d: CurrentTaskSet() = %v, want %v", i, current, step.current)
+		}
+		if l.Status() == StatusInterrupt {
+			t.Fatalf("step %d: user is interrupted", i)
+		}
+	}
+
+	// 未进入任务集合时不做处理
+	l.InterruptTaskSet()
+	if l.CurrentTaskSet() != nil || l.Status() == StatusInterrupt {
+		t.Fatal("InterruptTaskSet out of task sets should do nothing")
+	}
+}
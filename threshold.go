@@ -0,0 +1,197 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Hellowlonewolf/navigator/boomer"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// thresholdInterval 运行中检查阈值的间隔
+var thresholdInterval = time.Second
+
+// exit 阈值未通过时退出进程，测试中替换
+var exit = os.Exit
+
+// ErrThresholdsFailed 有阈值未通过
+var ErrThresholdsFailed = errors.New("thresholds failed")
+
+// thresholdWatcher 运行中定时检查设置了 Abort 的阈值，未通过时调用 end 结束压测，
+// 开始后 AbortDelay 内以及统计数据中还没有请求时不结束压测。压测结束时使用最后的统计数据检查所有阈值
+type thresholdWatcher struct {
+	thresholds []*boomer.Threshold
+	stats      func() *boomer.StatsSnapshot
+	end        func()
+
+	// startTime 开始检查的时间，用于计算 AbortDelay
+	startTime time.Time
+
+	mutex    sync.Mutex
+	last     *boomer.StatsSnapshot
+	results  []boomer.ThresholdResult
+	passed   bool
+	started  bool
+	finished bool
+
+	stopping chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	endOnce  sync.Once
+}
+
+// newThresholdWatcher 创建阈值检查，未设置阈值时返回 nil，阈值表达式错误时返回错误
+func newThresholdWatcher(thresholds []*boomer.Threshold, stats func() *boomer.StatsSnapshot, end func()) (*thresholdWatcher, error) {
+	if len(thresholds) == 0 {
+		return nil, nil
+	}
+	for _, t := range thresholds {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &thresholdWatcher{
+		thresholds: thresholds,
+		stats:      stats,
+		end:        end,
+		passed:     true,
+		stopping:   make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// start 开始定时检查阈值
+func (w *thresholdWatcher) start() {
+	if w == nil {
+		return
+	}
+	w.started = true
+	w.startTime = time.Now()
+	go w.run()
+}
+
+func (w *thresholdWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(thresholdInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check 获取统计数据并检查阈值，设置了 Abort 的阈值未通过时结束压测
+func (w *thresholdWatcher) check() {
+	snapshot := w.stats()
+	if snapshot == nil {
+		return
+	}
+	results, passed := boomer.EvaluateThresholds(snapshot, w.thresholds)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.finished {
+		return
+	}
+	w.last, w.results, w.passed = snapshot, results, passed
+
+	for _, result := range results {
+		if w.abort(result) {
+			w.endOnce.Do(func() {
+				log.Printf("threshold breached, stop the test: %v\n", result)
+				go w.end()
+			})
+			return
+		}
+	}
+}
+
+// abort 阈值未通过且需要结束压测，加压中还没有请求或在 AbortDelay 内时不结束
+func (w *thresholdWatcher) abort(result boomer.ThresholdResult) bool {
+	t := result.Threshold
+	if result.Passed || !t.Abort || result.NoRequests {
+		return false
+	}
+	return time.Since(w.startTime) >= t.AbortDelay
+}
+
+// stop 停止定时检查，使用最后的统计数据检查所有阈值，压测结束后统计数据不可用时使用上一次检查时的统计数据
+func (w *thresholdWatcher) stop() {
+	if w == nil {
+		return
+	}
+	w.stopOnce.Do(func() {
+		close(w.stopping)
+		if w.started {
+			<-w.done
+		}
+
+		snapshot := w.stats()
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if snapshot == nil {
+			snapshot = w.last
+		}
+		w.results, w.passed = boomer.EvaluateThresholds(snapshot, w.thresholds)
+		w.finished = true
+	})
+}
+
+// report 输出阈值检查结果
+func (w *thresholdWatcher) report(out io.Writer) {
+	results, passed := w.result()
+	var b strings.Builder
+	b.WriteString("Thresholds:\n")
+	for _, result := range results {
+		fmt.Fprintf(&b, "  %v\n", result)
+	}
+	if passed {
+		b.WriteString("All thresholds passed\n")
+	} else {
+		b.WriteString("Some thresholds failed\n")
+	}
+	fmt.Fprint(out, b.String())
+}
+
+func (w *thresholdWatcher) result() ([]boomer.ThresholdResult, bool) {
+	if w == nil {
+		return nil, true
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]boomer.ThresholdResult{}, w.results...), w.passed
+}
+
+// ThresholdResults 获取阈值检查结果，运行中为最近一次检查的结果，压测结束后为最终结果，
+// passed 为 false 时有阈值未通过，未设置阈值时返回 nil 与 true
+func (l *Lead) ThresholdResults() (results []boomer.ThresholdResult, passed bool) {
+	return l.thresholds.result()
+}
+
+// exitOnThresholds Run 结束时输出阈值检查结果，有阈值未通过时以状态码1退出
+func (l *Lead) exitOnThresholds() {
+	w := l.thresholds
+	if w == nil {
+		return
+	}
+	w.stop()
+	w.report(os.Stdout)
+	if _, passed := w.result(); !passed {
+		log.Println(ErrThresholdsFailed)
+		exit(1)
+	}
+}
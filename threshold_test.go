@@ -0,0 +1,282 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:06
+ */
+package navigator
+
+import (
+	"github.com/Hellowlonewolf/navigator/boomer"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStats 测试用的统计数据，set 后 get 返回新的数据
+type fakeStats struct {
+	mutex    sync.Mutex
+	snapshot *boomer.StatsSnapshot
+}
+
+func (s *fakeStats) set(snapshot *boomer.StatsSnapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshot = snapshot
+}
+
+func (s *fakeStats) get() *boomer.StatsSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshot
+}
+
+func statsWithFailures(requests, failures int64) *boomer.StatsSnapshot {
+	return &boomer.StatsSnapshot{Total: &boomer.EntrySnapshot{
+		NumRequests:   requests,
+		NumFailures:   failures,
+		ResponseTimes: map[int64]int64{100: requests},
+	}}
+}
+
+func setThresholdInterval(t *testing.T, interval time.Duration) {
+	old := thresholdInterval
+	thresholdInterval = interval
+	t.Cleanup(func() { thresholdInterval = old })
+}
+
+func TestNewThresholdWatcher(t *testing.T) {
+	w, err := newThresholdWatcher(nil, nil, nil)
+	if w != nil || err != nil {
+		t.Fatalf("unexpected watcher without thresholds: %v, err: %v", w, err)
+	}
+	if _, err = newThresholdWatcher([]*boomer.Threshold{{Expr: "p95 < 300"}}, nil, nil); err == nil {
+		t.Fatal("invalid threshold is accepted")
+	}
+}
+
+func TestThresholdWatcherAbort(t *testing.T) {
+	setThresholdInterval(t, 10*time.Millisecond)
+	stats := &fakeStats{}
+	ended := make(chan struct{})
+	var ends int32
+	w, err := newThresholdWatcher([]*boomer.Threshold{
+		{Expr: "fail_ratio < 0.1", Abort: true},
+	}, stats.get, func() {
+		if atomic.AddInt32(&ends, 1) == 1 {
+			close(ended)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.start()
+	defer w.stop()
+
+	// 没有统计数据时不检查
+	stats.set(nil)
+	time.Sleep(50 * time.Millisecond)
+	stats.set(statsWithFailures(100, 1))
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&ends) != 0 {
+		t.Fatal("test is ended while thresholds are passed")
+	}
+	if _, passed := w.result(); !passed {
+		t.Fatal("thresholds are failed while running")
+	}
+
+	stats.set(statsWithFailures(100, 50))
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("test is not ended when the threshold is breached")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&ends); n != 1 {
+		t.Fatalf("test is ended %d times", n)
+	}
+}
+
+func TestThresholdWatcherAbortWhileRampingUp(t *testing.T) {
+	setThresholdInterval(t, 10*time.Millisecond)
+	tests := []struct {
+		name      string
+		threshold *boomer.Threshold
+		// rampUp 加压中的统计数据，此时阈值未通过
+		rampUp *boomer.StatsSnapshot
+	}{
+		{
+			name:      "no requests yet",
+			threshold: &boomer.Threshold{Name: "/order", Expr: "requests >= 10", Abort: true},
+			rampUp:    statsWithFailures(5, 0),
+		},
+		{
+			name:      "within the abort delay",
+			threshold: &boomer.Threshold{Expr: "requests >= 10", Abort: true, AbortDelay: 200 * time.Millisecond},
+			rampUp:    statsWithFailures(5, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &fakeStats{snapshot: tt.rampUp}
+			var ends int32
+			w, err := newThresholdWatcher([]*boomer.Threshold{tt.threshold}, stats.get, func() { atomic.AddInt32(&ends, 1) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.start()
+			time.Sleep(100 * time.Millisecond)
+			if _, passed := w.result(); passed {
+				t.Fatal("threshold is passed while ramping up")
+			}
+
+			// 加压完成后阈值通过
+			snapshot := statsWithFailures(20, 0)
+			snapshot.Entries = []*boomer.EntrySnapshot{{Name: "/order", NumRequests: 20}}
+			stats.set(snapshot)
+			time.Sleep(200 * time.Millisecond)
+			w.stop()
+			if n := atomic.LoadInt32(&ends); n != 0 {
+				t.Fatalf("test is ended %d times while ramping up", n)
+			}
+			if results, passed := w.result(); !passed {
+				t.Fatalf("thresholds are failed after ramping up: %v", results)
+			}
+		})
+	}
+
+	// AbortDelay 之后未通过时结束压测
+	stats := &fakeStats{snapshot: statsWithFailures(5, 0)}
+	ended := make(chan struct{})
+	w, err := newThresholdWatcher([]*boomer.Threshold{{Expr: "requests >= 10", Abort: true, AbortDelay: 50 * time.Millisecond}}, stats.get, func() { close(ended) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	w.start()
+	defer w.stop()
+	select {
+	case <-ended:
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("test is ended after %v, before the abort delay", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("test is not ended after the abort delay")
+	}
+}
+
+func TestThresholdWatcherFinalResult(t *testing.T) {
+	setThresholdInterval(t, 10*time.Millisecond)
+	tests := []struct {
+		name       string
+		thresholds []*boomer.Threshold
+		running    *boomer.StatsSnapshot
+		final      *boomer.StatsSnapshot
+		passed     bool
+	}{
+		{
+			name:       "final stats passed",
+			thresholds: []*boomer.Threshold{{Expr: "fail_ratio < 0.1"}, {Expr: "p(95) < 300"}},
+			running:    statsWithFailures(10, 5),
+			final:      statsWithFailures(100, 5),
+			passed:     true,
+		},
+		{
+			name:       "final stats failed",
+			thresholds: []*boomer.Threshold{{Expr: "fail_ratio < 0.1"}, {Expr: "p(95) < 50"}},
+			running:    statsWithFailures(100, 5),
+			final:      statsWithFailures(100, 5),
+			passed:     false,
+		},
+		{
+			name:       "last stats are used after the test is stopped",
+			thresholds: []*boomer.Threshold{{Expr: "fail_ratio < 0.1"}},
+			running:    statsWithFailures(100, 50),
+			passed:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &fakeStats{}
+			var ends int32
+			w, err := newThresholdWatcher(tt.thresholds, stats.get, func() { atomic.AddInt32(&ends, 1) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.start()
+			stats.set(tt.running)
+			time.Sleep(50 * time.Millisecond)
+			stats.set(tt.final)
+			w.stop()
+
+			results, passed := w.result()
+			if passed != tt.passed || len(results) != len(tt.thresholds) {
+				t.Fatalf("unexpected results: %v, passed: %v", results, passed)
+			}
+			if atomic.LoadInt32(&ends) != 0 {
+				t.Fatal("test is ended by a threshold without Abort")
+			}
+
+			// 结束后不再更新结果
+			stats.set(statsWithFailures(1, 0))
+			w.check()
+			if _, again := w.result(); again != passed {
+				t.Fatal("results are changed after the watcher is stopped")
+			}
+		})
+	}
+}
+
+func TestExitOnThresholds(t *testing.T) {
+	oldExit := exit
+	defer func() { exit = oldExit }()
+
+	tests := []struct {
+		name     string
+		expr     string
+		exitCode int
+	}{
+		{name: "passed", expr: "fail_ratio < 0.1", exitCode: -1},
+		{name: "failed", expr: "fail_ratio < 0.01", exitCode: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := -1
+			exit = func(c int) { code = c }
+
+			stats := &fakeStats{snapshot: statsWithFailures(100, 5)}
+			w, err := newThresholdWatcher([]*boomer.Threshold{{Expr: tt.expr}}, stats.get, func() {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := &Lead{thresholds: w}
+			l.exitOnThresholds()
+			if code != tt.exitCode {
+				t.Fatalf("exit code %d, expected %d", code, tt.exitCode)
+			}
+		})
+	}
+
+	code := -1
+	exit = func(c int) { code = c }
+	(&Lead{}).exitOnThresholds()
+	if code != -1 {
+		t.Fatal("exit without thresholds")
+	}
+}
+
+func TestRunStatsUsesBoomerClient(t *testing.T) {
+	l := New(Thresholds(&boomer.Threshold{Expr: "fail_ratio < 0.01"}))
+	if l.runStats() != nil {
+		t.Fatal("stats of the default boomer are not nil before the test is started")
+	}
+
+	// 负载曲线创建的单机 boomer 在创建阈值检查后才设置时，仍应使用其统计数据
+	stats := l.runStats
+	b := boomer.NewStandaloneBoomer(0, 0)
+	l.option.boomerClient = b
+	b.Start()
+	defer b.Quit()
+	if stats() == nil {
+		t.Fatal("stats of the boomer client are not used")
+	}
+}
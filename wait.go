@@ -0,0 +1,107 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// maxWait 随机等待时间的上限，长尾分布的取样超过上限时按上限等待，避免转换为 time.Duration 时溢出为负数
+const maxWait = time.Hour
+
+// 随机数函数，测试时可替换为固定种子的随机数
+var (
+	randInt63n      = rand.Int63n
+	randFloat64     = rand.Float64
+	randExpFloat64  = rand.ExpFloat64
+	randNormFloat64 = rand.NormFloat64
+)
+
+// waitDuration 将随机取样转换为等待时间，超过 maxWait 时返回 maxWait
+func waitDuration(d float64) time.Duration {
+	if d >= float64(maxWait) {
+		return maxWait
+	}
+	return time.Duration(d)
+}
+
+// WaitTimeFunc 虚拟用户执行任务后的等待时间（思考时间）策略，参考 locust 的 wait_time。
+// elapsed 为本次任务的执行耗时，返回本次任务后需要等待的时间，小于等于0时不等待。
+type WaitTimeFunc func(elapsed time.Duration) time.Duration
+
+// WaitTimer 可选接口，虚拟用户实现该接口后，使用自己的等待时间策略。
+// *Line 已实现该接口，可通过 SetWaitTime 设置，也可以重写 WaitTime 方法。
+type WaitTimer interface {
+	// WaitTime 返回虚拟用户的等待时间策略，返回 nil 时使用 Lead 的等待时间设置
+	WaitTime() WaitTimeFunc
+}
+
+// Between 在 min 与 max 之间均匀随机等待，同 locust 的 between
+func Between(min, max time.Duration) WaitTimeFunc {
+	if max < min {
+		min, max = max, min
+	}
+	return func(elapsed time.Duration) time.Duration {
+		if max == min {
+			return min
+		}
+		return min + time.Duration(randInt63n(int64(max-min)))
+	}
+}
+
+// Constant 固定等待 d，同 locust 的 constant
+func Constant(d time.Duration) WaitTimeFunc {
+	return func(elapsed time.Duration) time.Duration {
+		return d
+	}
+}
+
+// ConstantPacing 保证任务每 d 执行一次，任务执行耗时超过 d 时不等待，同 locust 的 constant_pacing
+// |--------------- d time -------------------------|
+// |--- task running time ---|--- wait time --------|
+func ConstantPacing(d time.Duration) WaitTimeFunc {
+	return func(elapsed time.Duration) time.Duration {
+		return d - elapsed
+	}
+}
+
+// ConstantThroughput 保证每个虚拟用户每秒执行 taskRunsPerSecond 次任务，同 locust 的 constant_throughput
+func ConstantThroughput(taskRunsPerSecond float64) WaitTimeFunc {
+	if taskRunsPerSecond <= 0 {
+		return Constant(0)
+	}
+	return ConstantPacing(time.Duration(float64(time.Second) / taskRunsPerSecond))
+}
+
+// Exponential 按均值为 mean 的指数分布随机等待，适用于模拟相互独立的用户操作间隔。
+// 取样超过 1 小时（maxWait）时按 1 小时等待，即分布在 1 小时处截断，mean 接近或超过 1 小时时实际均值小于 mean
+func Exponential(mean time.Duration) WaitTimeFunc {
+	return func(elapsed time.Duration) time.Duration {
+		return waitDuration(randExpFloat64() * float64(mean))
+	}
+}
+
+// Normal 按均值为 mean、标准差为 stdDev 的正态分布随机等待，小于0时不等待。
+// 取样超过 1 小时（maxWait）时按 1 小时等待，即分布在 1 小时处截断
+func Normal(mean, stdDev time.Duration) WaitTimeFunc {
+	return func(elapsed time.Duration) time.Duration {
+		return waitDuration(randNormFloat64()*float64(stdDev) + float64(mean))
+	}
+}
+
+// Pareto 按最小值为 scale、形状参数为 shape 的帕累托分布随机等待，
+// 大部分等待时间接近 scale，少量等待时间很长，shape 越小长尾越明显。
+// 取样超过 1 小时（maxWait）时按 1 小时等待，即长尾在 1 小时处截断，shape 很小时实际均值明显小于理论均值
+func Pareto(scale time.Duration, shape float64) WaitTimeFunc {
+	if shape <= 0 {
+		return Constant(scale)
+	}
+	return func(elapsed time.Duration) time.Duration {
+		// 1-randFloat64() 取值范围为 (0,1]，避免除0
+		return waitDuration(float64(scale) / math.Pow(1-randFloat64(), 1/shape))
+	}
+}
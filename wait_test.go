@@ -0,0 +1,112 @@
+/**
+ * @author zhagnxiaoping
+ * @date  2024/6/15 12:05
+ */
+package navigator
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// seedRand 使用固定种子的随机数，测试结束后恢复
+func seedRand(t *testing.T) {
+	oldInt63n, oldFloat64, oldExp, oldNorm := randInt63n, randFloat64, randExpFloat64, randNormFloat64
+	r := rand.New(rand.NewSource(1))
+	randInt63n, randFloat64, randExpFloat64, randNormFloat64 = r.Int63n, r.Float64, r.ExpFloat64, r.NormFloat64
+	t.Cleanup(func() {
+		randInt63n, randFloat64, randExpFloat64, randNormFloat64 = oldInt63n, oldFloat64, oldExp, oldNorm
+	})
+}
+
+func TestWaitTimeBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      WaitTimeFunc
+		elapsed time.Duration
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "between", fn: Between(time.Second, 2*time.Second), min: time.Second, max: 2*time.Second - 1},
+		{name: "between swapped", fn: Between(2*time.Second, time.Second), min: time.Second, max: 2*time.Second - 1},
+		{name: "between equal", fn: Between(time.Second, time.Second), min: time.Second, max: time.Second},
+		{name: "constant", fn: Constant(time.Second), elapsed: 3 * time.Second, min: time.Second, max: time.Second},
+		{name: "constant pacing", fn: ConstantPacing(time.Second), elapsed: 300 * time.Millisecond, min: 700 * time.Millisecond, max: 700 * time.Millisecond},
+		{name: "constant pacing slow task", fn: ConstantPacing(time.Second), elapsed: 3 * time.Second, min: math.MinInt64, max: 0},
+		{name: "constant throughput", fn: ConstantThroughput(4), elapsed: 50 * time.Millisecond, min: 200 * time.Millisecond, max: 200 * time.Millisecond},
+		{name: "constant throughput zero", fn: ConstantThroughput(0), min: 0, max: 0},
+		{name: "exponential", fn: Exponential(time.Second), min: 0, max: maxWait},
+		{name: "exponential long mean", fn: Exponential(100 * 365 * 24 * time.Hour), min: 0, max: maxWait},
+		{name: "normal", fn: Normal(time.Second, 10*time.Second), min: math.MinInt64, max: maxWait},
+		{name: "pareto", fn: Pareto(time.Second, 1.5), min: time.Second, max: maxWait},
+		{name: "pareto long tail", fn: Pareto(time.Minute, 0.01), min: time.Minute, max: maxWait},
+		{name: "pareto invalid shape", fn: Pareto(time.Second, 0), min: time.Second, max: time.Second},
+	}
+	seedRand(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 10000; i++ {
+				if d := tt.fn(tt.elapsed); d < tt.min || d > tt.max {
+					t.Fatalf("wait time %v, want between %v and %v", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestParetoMaxWait(t *testing.T) {
+	seedRand(t)
+	// 取样接近 1 时等待时间超过 time.Duration 的范围
+	randFloat64 = func() float64 { return 1 - 1e-300 }
+	if d := Pareto(time.Second, 1)(0); d != maxWait {
+		t.Fatalf("wait time %v, want %v", d, maxWait)
+	}
+	randFloat64 = func() float64 { return 0 }
+	if d := Pareto(time.Second, 1)(0); d != time.Second {
+		t.Fatalf("wait time %v, want %v", d, time.Second)
+	}
+}
+
+func TestWaitTimeDistribution(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     WaitTimeFunc
+		mean   time.Duration
+		stdDev time.Duration
+	}{
+		{name: "between", fn: Between(100*time.Millisecond, 300*time.Millisecond), mean: 200 * time.Millisecond},
+		{name: "exponential", fn: Exponential(time.Second), mean: time.Second, stdDev: time.Second},
+		{name: "normal", fn: Normal(time.Second, 100*time.Millisecond), mean: time.Second, stdDev: 100 * time.Millisecond},
+		// 帕累托分布的均值为 shape*scale/(shape-1)
+		{name: "pareto", fn: Pareto(100*time.Millisecond, 3), mean: 150 * time.Millisecond},
+	}
+	const n = 100000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedRand(t)
+			samples := make([]float64, n)
+			var sum float64
+			for i := range samples {
+				samples[i] = float64(tt.fn(0))
+				sum += samples[i]
+			}
+			mean := sum / n
+			if math.Abs(mean-float64(tt.mean)) > 0.03*float64(tt.mean) {
+				t.Fatalf("mean %v, want %v", time.Duration(mean), tt.mean)
+			}
+			if tt.stdDev == 0 {
+				return
+			}
+			var variance float64
+			for _, s := range samples {
+				variance += (s - mean) * (s - mean)
+			}
+			stdDev := math.Sqrt(variance / n)
+			if math.Abs(stdDev-float64(tt.stdDev)) > 0.03*float64(tt.stdDev) {
+				t.Fatalf("standard deviation %v, want %v", time.Duration(stdDev), tt.stdDev)
+			}
+		})
+	}
+}